@@ -6,10 +6,10 @@ import (
 )
 
 func (logger *Logger) Debug(debug string, extra ...interface{}) {
-	if !logger.CheckLevel(DEBUG) {
+	if !logger.CheckLevel(DEBUG) || !logger.checkLimit(standard.LogTypeDebug, debug) {
 		return
 	}
-	logger.Log(standard.DebugLog{
+	logger.logLimited(standard.DebugLog{
 		BaseLog:    logger.MakeBaseLog(standard.LogTypeDebug, extra...),
 		CallStacks: logger.getCallStacks(),
 		Debug:      debug,
@@ -17,24 +17,24 @@ func (logger *Logger) Debug(debug string, extra ...interface{}) {
 }
 
 func (logger *Logger) Info(info string, extra ...interface{}) {
-	if !logger.CheckLevel(INFO) {
+	if !logger.CheckLevel(INFO) || !logger.checkLimit(standard.LogTypeInfo, info) {
 		return
 	}
-	logger.Log(standard.InfoLog{
+	logger.logLimited(standard.InfoLog{
 		BaseLog: logger.MakeBaseLog(standard.LogTypeInfo, extra...),
 		Info:    info,
 	})
 }
 
 func (logger *Logger) Warning(warning string, extra ...interface{}) {
-	if logger.CheckLevel(WARNING) {
-		logger.Log(logger.MakeWarningLog(standard.LogTypeWarning, warning, extra...))
+	if logger.CheckLevel(WARNING) && logger.checkLimit(standard.LogTypeWarning, warning) {
+		logger.logLimited(logger.MakeWarningLog(standard.LogTypeWarning, warning, extra...))
 	}
 }
 
 func (logger *Logger) Error(error string, extra ...interface{}) {
-	if logger.CheckLevel(ERROR) {
-		logger.Log(logger.MakeErrorLog(standard.LogTypeError, error, extra...))
+	if logger.CheckLevel(ERROR) && logger.checkLimit(standard.LogTypeError, error) {
+		logger.logLimited(logger.MakeErrorLog(standard.LogTypeError, error, extra...))
 	}
 }
 
@@ -84,8 +84,13 @@ func (logger *Logger) MakeBaseLog(logType string, extra ...interface{}) standard
 	baseLog.Extra = map[string]interface{}{}
 	if len(extra) == 1 {
 		if mapData, ok := extra[0].(map[string]interface{}); ok {
-			baseLog.Extra = mapData
-			return baseLog
+			if len(logger.fields) == 0 {
+				baseLog.Extra = mapData
+				return baseLog
+			}
+			for k, v := range mapData {
+				baseLog.Extra[k] = v
+			}
 		}
 	}
 	if len(extra) > 1 {
@@ -95,5 +100,11 @@ func (logger *Logger) MakeBaseLog(logType string, extra ...interface{}) standard
 			}
 		}
 	}
+	// 合并通过 With 绑定的字段，调用时传入的同名字段优先
+	for k, v := range logger.fields {
+		if _, ok := baseLog.Extra[k]; !ok {
+			baseLog.Extra[k] = v
+		}
+	}
 	return baseLog
 }
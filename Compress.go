@@ -0,0 +1,156 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ssgo/standard"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// compressExt 返回压缩文件的扩展名，非压缩文件返回空字符串
+func compressExt(fileName string) string {
+	if strings.HasSuffix(fileName, ".gz") {
+		return ".gz"
+	} else if strings.HasSuffix(fileName, ".zst") {
+		return ".zst"
+	}
+	return ""
+}
+
+// compressFile 将日志文件压缩为 .gz 或 .zst 并删除原文件，目标文件已存在时追加为新的压缩帧
+func compressFile(fileName, method string) error {
+	var ext string
+	switch method {
+	case "gzip", "gz":
+		ext = ".gz"
+	case "zstd", "zst":
+		ext = ".zst"
+	default:
+		return fmt.Errorf("unsupported log compress method %s", method)
+	}
+
+	src, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(fileName+ext, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	var zw io.WriteCloser
+	if ext == ".gz" {
+		zw = gzip.NewWriter(dst)
+	} else {
+		zw, err = zstd.NewWriter(dst)
+		if err != nil {
+			_ = dst.Close()
+			return err
+		}
+	}
+
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	} else {
+		_ = zw.Close()
+	}
+	if err2 := dst.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+	_ = src.Close()
+	return os.Remove(fileName)
+}
+
+type logFileReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *logFileReader) Close() error {
+	var err error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if err2 := r.closers[i].Close(); err == nil {
+			err = err2
+		}
+	}
+	return err
+}
+
+type zstdCloser struct {
+	decoder *zstd.Decoder
+}
+
+func (c zstdCloser) Close() error {
+	c.decoder.Close()
+	return nil
+}
+
+// OpenLogFile 打开日志文件，gzip、zstd 压缩的文件自动解压
+func OpenLogFile(fileName string) (io.ReadCloser, error) {
+	fp, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(fp)
+	r := &logFileReader{Reader: br, closers: []io.Closer{fp}}
+	head, _ := br.Peek(4)
+	if bytes.HasPrefix(head, gzipMagic) {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			_ = fp.Close()
+			return nil, err
+		}
+		r.Reader = gr
+		r.closers = append(r.closers, gr)
+	} else if bytes.HasPrefix(head, zstdMagic) {
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			_ = fp.Close()
+			return nil, err
+		}
+		r.Reader = zr
+		r.closers = append(r.closers, zstdCloser{decoder: zr})
+	}
+	return r, nil
+}
+
+// ReadLogFile 逐行读取日志文件，支持压缩的历史日志文件
+func ReadLogFile(fileName string, f func(line string)) error {
+	r, err := OpenLogFile(fileName)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		f(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// ParseLogFile 逐行解析日志文件，无法识别的行会被忽略
+func ParseLogFile(fileName string, f func(baseLog *standard.BaseLog)) error {
+	return ReadLogFile(fileName, func(line string) {
+		if baseLog := ParseBaseLog(line); baseLog != nil {
+			f(baseLog)
+		}
+	})
+}
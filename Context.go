@@ -0,0 +1,52 @@
+package log
+
+import (
+	"context"
+)
+
+type contextKey struct{}
+
+var loggerContextKey = contextKey{}
+
+// NewContext 返回携带 Logger 的 Context，Logger 中的 traceId 和通过 With 绑定的字段会随 Context 传递
+func NewContext(ctx context.Context, logger *Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey, logger)
+}
+
+// FromContext 返回 Context 中携带的 Logger，没有时返回 DefaultLogger，Context 中存在 OpenTelemetry Span 时使用其 traceId 和 spanId
+func FromContext(ctx context.Context) *Logger {
+	logger := contextLogger(ctx)
+	if logger == nil {
+		logger = DefaultLogger
+	}
+	return withSpanContext(ctx, logger)
+}
+
+// ContextWith 返回绑定了字段的 Context
+func ContextWith(ctx context.Context, keyAndValues ...interface{}) context.Context {
+	return NewContext(ctx, FromContext(ctx).With(keyAndValues...))
+}
+
+func contextLogger(ctx context.Context) *Logger {
+	if ctx == nil {
+		return nil
+	}
+	logger, _ := ctx.Value(loggerContextKey).(*Logger)
+	return logger
+}
+
+func DebugCtx(ctx context.Context, debug string, extra ...interface{}) {
+	FromContext(ctx).Debug(debug, extra...)
+}
+
+func InfoCtx(ctx context.Context, info string, extra ...interface{}) {
+	FromContext(ctx).Info(info, extra...)
+}
+
+func WarningCtx(ctx context.Context, warning string, extra ...interface{}) {
+	FromContext(ctx).Warning(warning, extra...)
+}
+
+func ErrorCtx(ctx context.Context, error string, extra ...interface{}) {
+	FromContext(ctx).Error(error, extra...)
+}
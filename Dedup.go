@@ -0,0 +1,131 @@
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ssgo/standard"
+	"github.com/ssgo/u"
+)
+
+// deduper 合并窗口内连续重复的日志，第一条立即记录，之后重复的日志在窗口结束或出现其他日志时合并为一条，记录重复次数和首末时间
+type deduper struct {
+	window    time.Duration
+	key       string
+	startTime time.Time
+	pending   *dedupEntry
+	timer     *time.Timer
+	lock      sync.Mutex
+}
+
+type dedupEntry struct {
+	logger    *Logger
+	data      interface{}
+	repeated  int
+	firstTime time.Time
+	lastTime  time.Time
+}
+
+func newDeduper(conf *Config) *deduper {
+	if conf.Dedup == "" {
+		return nil
+	}
+	window := parseDuration(conf.Dedup)
+	if window <= 0 {
+		return nil
+	}
+	return &deduper{window: window}
+}
+
+// check 判断日志是否需要立即记录，重复的日志返回 false
+func (d *deduper) check(logger *Logger, data interface{}) bool {
+	key := getDedupKey(data)
+	now := time.Now()
+	d.lock.Lock()
+	if key != "" && key == d.key && now.Sub(d.startTime) < d.window {
+		if d.pending == nil {
+			d.pending = &dedupEntry{firstTime: now}
+			d.timer = time.AfterFunc(d.window-now.Sub(d.startTime), d.flush)
+		}
+		d.pending.logger = logger
+		d.pending.data = data
+		d.pending.repeated++
+		d.pending.lastTime = now
+		d.lock.Unlock()
+		return false
+	}
+	pending := d.take()
+	d.key = key
+	d.startTime = now
+	d.lock.Unlock()
+	pending.emit()
+	return true
+}
+
+// take 取出等待合并的日志，需要在加锁后调用
+func (d *deduper) take() *dedupEntry {
+	pending := d.pending
+	d.pending = nil
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	return pending
+}
+
+// flush 立即记录等待合并的日志
+func (d *deduper) flush() {
+	d.lock.Lock()
+	pending := d.take()
+	d.lock.Unlock()
+	pending.emit()
+}
+
+func (e *dedupEntry) emit() {
+	if e == nil {
+		return
+	}
+	e.logger.log(e.data, fmt.Sprintf("\"Repeated\":%d,\"FirstTime\":\"%s\",\"LastTime\":\"%s\"", e.repeated, MakeLogTime(e.firstTime), MakeLogTime(e.lastTime)))
+}
+
+// getDedupKey 返回用于判断重复的 logType、消息和调用栈，不包含消息的日志返回空字符串
+func getDedupKey(data interface{}) string {
+	key := getLogKey(data)
+	if key == "" {
+		return ""
+	}
+	var callStacks interface{}
+	switch v := data.(type) {
+	case standard.ErrorLog:
+		callStacks = v.CallStacks
+	case *standard.ErrorLog:
+		callStacks = v.CallStacks
+	case standard.WarningLog:
+		callStacks = v.CallStacks
+	case *standard.WarningLog:
+		callStacks = v.CallStacks
+	case standard.DebugLog:
+		callStacks = v.CallStacks
+	case *standard.DebugLog:
+		callStacks = v.CallStacks
+	case standard.DBErrorLog:
+		callStacks = v.CallStacks
+	case *standard.DBErrorLog:
+		callStacks = v.CallStacks
+	case standard.ServerErrorLog:
+		callStacks = v.CallStacks
+	case *standard.ServerErrorLog:
+		callStacks = v.CallStacks
+	case map[string]interface{}:
+		callStacks = v["callStacks"]
+	}
+	if stacks, ok := callStacks.([]string); ok {
+		return key + "\n" + strings.Join(stacks, "\n")
+	}
+	if callStacks != nil {
+		return key + "\n" + u.String(callStacks)
+	}
+	return key
+}
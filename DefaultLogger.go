@@ -9,6 +9,15 @@ var DefaultLogger *Logger
 func init() {
 	RegisterWriterMaker("es", esWriterMaker)
 	RegisterWriterMaker("ess", esWriterMaker)
+	RegisterWriterMaker("syslog", syslogWriterMaker)
+	RegisterWriterMaker("syslog+tcp", syslogWriterMaker)
+	RegisterWriterMaker("unixgram", syslogWriterMaker)
+	RegisterWriterMaker("loki", lokiWriterMaker)
+	RegisterWriterMaker("lokis", lokiWriterMaker)
+	RegisterWriterMaker("otlp", otlpWriterMaker)
+	RegisterWriterMaker("otlps", otlpWriterMaker)
+	RegisterWriterMaker("http", webhookWriterMaker)
+	RegisterWriterMaker("https", webhookWriterMaker)
 
 	conf := Config{}
 	config.LoadConfig("log", &conf)
@@ -1,8 +1,16 @@
 package log_test
 
 import (
+	"context"
 	"github.com/ssgo/log"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 
@@ -25,3 +33,207 @@ func TestES(t *testing.T) {
 	//imageName = strings.SplitN(imageName, "#", 2)[0]
 	//fmt.Println(" ^^^", imageName)
 }
+
+func TestESSpool(t *testing.T) {
+	failed := int32(1)
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&failed) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+		_, _ = w.Write([]byte(`{"took":1,"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	spool := t.TempDir()
+	logger := log.NewLogger(log.Config{Name: "spoolTest", FlushInterval: "10ms", File: "es://" + server.Listener.Addr().String() + "/test?spool=" + spool + "&retryMax=100ms"})
+	logger.Info("spool test")
+	time.Sleep(50 * time.Millisecond)
+	files, _ := filepath.Glob(filepath.Join(spool, "*.bulk"))
+	if len(files) != 1 {
+		t.Fatal("es spool write test failed", files)
+	}
+
+	atomic.StoreInt32(&failed, 0)
+	select {
+	case body := <-received:
+		if !strings.Contains(body, "spool test") || !strings.Contains(body, `"_index":"test.spoolTest"`) {
+			t.Error("es spool replay test failed", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("es spool replay timeout")
+	}
+	time.Sleep(10 * time.Millisecond)
+	files, _ = filepath.Glob(filepath.Join(spool, "*.bulk"))
+	if len(files) != 0 {
+		t.Error("es spool remove test failed", files)
+	}
+}
+
+func TestESBulkItems(t *testing.T) {
+	requests := int32(0)
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+		if atomic.AddInt32(&requests, 1) == 1 {
+			_, _ = w.Write([]byte(`{"took":1,"errors":true,"items":[{"index":{"_index":"test","status":400,"error":{"type":"mapper_parsing_exception","reason":"failed to parse field [level]"}}},{"index":{"_index":"test","status":429,"error":{"type":"es_rejected_execution_exception","reason":"rejected"}}}]}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"took":1,"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	deadLetter := filepath.Join(t.TempDir(), "rejected.log")
+	logger := log.NewLogger(log.Config{Name: "bulkTest", FlushInterval: "10ms", File: "es://" + server.Listener.Addr().String() + "/test?deadLetter=" + deadLetter})
+	logger.Info("bad doc")
+	logger.Info("retry doc")
+
+	<-received
+	select {
+	case body := <-received:
+		if strings.Contains(body, "bad doc") || !strings.Contains(body, "retry doc") {
+			t.Error("es bulk retry test failed", body)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("es bulk retry timeout")
+	}
+
+	rejected, _ := ioutil.ReadFile(deadLetter)
+	if !strings.Contains(string(rejected), "bad doc") || !strings.Contains(string(rejected), "failed to parse field [level]") {
+		t.Error("es dead letter test failed", string(rejected))
+	}
+}
+
+func TestESIndex(t *testing.T) {
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+		_, _ = w.Write([]byte(`{"took":1,"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	logger := log.NewLogger(log.Config{Name: "indexTest", FlushInterval: "10ms", File: "es://" + server.Listener.Addr().String() + "/test?index=logs-{name}-{2006.01.02}&dataStream=true"})
+	logger.Log(map[string]interface{}{"logTime": "2021-03-04T05:06:07.123Z", "info": "index test"})
+
+	select {
+	case body := <-received:
+		if !strings.Contains(body, `{"create":{"_index":"logs-indexTest-2021.03.04"}}`) || !strings.Contains(body, `"@timestamp":"2021-03-04T05:06:07.123Z"`) {
+			t.Error("es index test failed", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("es index timeout")
+	}
+}
+
+func TestESSpoolStartup(t *testing.T) {
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received <- string(body)
+		_, _ = w.Write([]byte(`{"took":1,"errors":false,"items":[]}`))
+	}))
+	defer server.Close()
+
+	// 启动时遗留的暂存数据在没有新日志时也会重放
+	spool := t.TempDir()
+	_ = ioutil.WriteFile(filepath.Join(spool, "00000000000000000001.bulk"), []byte("{\"index\":{\"_index\":\"test\"}}\n{\"info\":\"left over\"}\n"), 0644)
+	log.NewLogger(log.Config{Name: "spoolStartup", File: "es://" + server.Listener.Addr().String() + "/test?spool=" + spool})
+
+	select {
+	case body := <-received:
+		if !strings.Contains(body, "left over") {
+			t.Error("es spool startup test failed", body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("es spool startup replay timeout")
+	}
+}
+
+func TestESBulkItemRetry(t *testing.T) {
+	requests := int32(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write([]byte(`{"took":1,"errors":true,"items":[{"index":{"_index":"test","status":429,"error":{"type":"es_rejected_execution_exception","reason":"rejected"}}}]}`))
+	}))
+	defer server.Close()
+
+	// 没有暂存目录时按退避重试，超过重试次数后丢弃
+	logger := log.NewLogger(log.Config{Name: "itemRetryTest", FlushInterval: "10ms", File: "es://" + server.Listener.Addr().String() + "/test?itemRetry=2&retryMax=20ms"})
+	logger.Info("always rejected")
+	time.Sleep(300 * time.Millisecond)
+	if n := atomic.LoadInt32(&requests); n != 3 {
+		t.Error("es item retry limit test failed", n)
+	}
+}
+
+func TestESSpoolItemRetryOrder(t *testing.T) {
+	requests := int32(0)
+	received := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			_, _ = w.Write([]byte(`{"took":1,"errors":true,"items":[{"index":{"_index":"test","status":429,"error":{"type":"es_rejected_execution_exception","reason":"rejected"}}}]}`))
+		default:
+			received <- string(body)
+			_, _ = w.Write([]byte(`{"took":1,"errors":false,"items":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	// 重放时被限流的数据在之后暂存的数据之前重新发送
+	spool := t.TempDir()
+	logger := log.NewLogger(log.Config{Name: "spoolOrder", FlushInterval: "10ms", File: "es://" + server.Listener.Addr().String() + "/test?spool=" + spool + "&retryMax=200ms"})
+	logger.Info("first doc")
+	time.Sleep(50 * time.Millisecond)
+	logger.Info("second doc")
+
+	for _, expect := range []string{"first doc", "second doc"} {
+		select {
+		case body := <-received:
+			if !strings.Contains(body, expect) {
+				t.Error("es spool retry order test failed", expect, body)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("es spool retry order timeout", expect)
+		}
+	}
+}
+
+func TestESSpoolLost(t *testing.T) {
+	status := int32(http.StatusServiceUnavailable)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer server.Close()
+
+	// 暂存目录超出尺寸上限时丢弃的日志计入丢失的数量
+	spool := t.TempDir()
+	logger := log.NewLogger(log.Config{Name: "spoolLost", FlushInterval: "1h", File: "es://" + server.Listener.Addr().String() + "/test?spool=" + spool + "&spoolSize=10&retryMax=1h"})
+	logger.Info("lost 1")
+	logger.Info("lost 2")
+	if lost, _ := logger.Flush(context.Background()); lost != 0 {
+		t.Error("es spool write test failed", lost)
+	}
+	logger.Info("lost 3")
+	if lost, _ := logger.Flush(context.Background()); lost != 2 {
+		t.Error("es spool full lost test failed", lost)
+	}
+
+	// 重放时不可重试的错误丢弃整批数据
+	atomic.StoreInt32(&status, http.StatusBadRequest)
+	if lost, _ := logger.Close(context.Background()); lost != 1 {
+		t.Error("es spool replay lost test failed", lost)
+	}
+	files, _ := filepath.Glob(filepath.Join(spool, "*.bulk"))
+	if len(files) != 0 {
+		t.Error("es spool remove test failed", files)
+	}
+}
@@ -2,12 +2,18 @@ package log
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/ssgo/u"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -21,9 +27,47 @@ type esWriter struct {
 	group    string
 	lock     sync.Mutex
 	queue    []string
-	last     int64
 	client   *http.Client
 	prefix   string
+
+	action     string   // bulk 操作，数据流模式下使用 create
+	dataStream bool     // 是否写入数据流
+	index      []string // 索引名模版，奇数位为日志时间的格式
+
+	retries       []esRetryItem // 没有暂存目录时等待重新发送的数据
+	retryMaxItems int           // 等待重新发送的数据的最大数量
+	itemRetry     int           // 每条数据被 es 返回 429、503 时的最大重试次数，超过时丢弃
+	spool         string        // 发送失败的数据暂存目录，为空时不暂存
+	spoolMax      int64         // 暂存目录的最大尺寸，超出时丢弃最早的数据
+	spoolSize     int64         // 当前暂存数据的尺寸
+	spoolFiles    []string      // 待重放的暂存文件，按写入顺序排列
+	spoolSeq      int64         // 最后一个暂存文件的序号
+	spoolRetry    int           // 第一个暂存文件中的数据已经被重试的次数
+	spoolDropped  int           // 暂存目录超出尺寸上限时丢弃的日志数量，由 flush 计入丢失的数量
+	retryMax      time.Duration // 重试的最大间隔
+	backoff       time.Duration // 当前的重试间隔
+	nextRetry     time.Time     // 下一次重试的时间
+	deadLetter    string        // 被 es 拒绝的数据的存放文件，为空时输出到标准日志
+}
+
+type esRetryItem struct {
+	action string
+	doc    string
+	times  int // 已经重试的次数
+}
+
+type esBulkResponse struct {
+	Errors bool
+	Items  []map[string]esBulkItem
+}
+
+type esBulkItem struct {
+	Index  string `json:"_index"`
+	Status int
+	Error  *struct {
+		Type   string
+		Reason string
+	}
 }
 
 func esWriterMaker(conf *Config) Writer {
@@ -49,11 +93,40 @@ func esWriterMaker(conf *Config) Writer {
 		esUrl.Scheme = "http"
 	}
 
-	timeout := esUrl.Query().Get("timeout")
-	if timeout != "" {
+	q := esUrl.Query()
+	w.client.Timeout = 10 * time.Second
+	if timeout := q.Get("timeout"); timeout != "" {
 		w.client.Timeout = u.Duration(timeout)
 	}
 
+	// 发送失败时暂存到本地磁盘，es://host:port/group?spool=/data/spool&spoolSize=100M&retryMax=5m
+	w.spool = q.Get("spool")
+	w.spoolMax = ParseSize(q.Get("spoolSize"))
+	if w.spoolMax <= 0 {
+		w.spoolMax = 100 * 1024 * 1024
+	}
+	w.retryMax = parseDuration(q.Get("retryMax"))
+	if w.retryMax <= 0 {
+		w.retryMax = 5 * time.Minute
+	}
+	// 被拒绝的数据写入死信文件，es://host:port/group?deadLetter=/data/es_rejected.log
+	w.deadLetter = q.Get("deadLetter")
+	// 被 es 限流的数据最多重试的次数，es://host:port/group?itemRetry=3
+	w.itemRetry = 3
+	if itemRetry := q.Get("itemRetry"); itemRetry != "" {
+		w.itemRetry = u.Int(itemRetry)
+	}
+	w.retryMaxItems = conf.QueueSize
+	if w.retryMaxItems <= 0 {
+		w.retryMaxItems = defaultQueueSize
+	}
+	if w.spool != "" {
+		if err := w.loadSpool(); err != nil {
+			DefaultLogger.Error(err.Error(), "spool", w.spool)
+			w.spool = ""
+		}
+	}
+
 	if len(esUrl.Path) > 1 {
 		w.group = strings.ReplaceAll(esUrl.Path[1:], "/", ".")
 	}
@@ -63,68 +136,445 @@ func esWriterMaker(conf *Config) Writer {
 
 	w.url = esUrl.String()
 
-	if w.group != "" {
-		w.prefix = fmt.Sprintf("{\"index\":{\"_index\":\"%s.%s\"}}", w.group, w.config.Name)
+	// 数据流模式使用 create 操作，es://host:port/group?dataStream=true
+	w.action = "index"
+	if u.Bool(q.Get("dataStream")) {
+		w.dataStream = true
+		w.action = "create"
+	}
+
+	// 按日志时间生成索引名，{name} 为日志名称，{group} 为路径中的分组，其他 {} 中的内容为时间格式，如 ?index=logs-{name}-{2006.01.02}
+	if indexTemplate := q.Get("index"); indexTemplate != "" {
+		w.index = []string{""}
+		for _, part := range strings.Split(indexTemplate, "{") {
+			a := strings.SplitN(part, "}", 2)
+			if len(a) == 1 {
+				w.index[len(w.index)-1] += a[0]
+				continue
+			}
+			switch a[0] {
+			case "name":
+				w.index[len(w.index)-1] += w.config.Name + a[1]
+			case "group":
+				w.index[len(w.index)-1] += w.group + a[1]
+			default:
+				w.index = append(w.index, a[0], a[1])
+			}
+		}
+		if len(w.index) == 1 {
+			w.prefix = fmt.Sprintf("{\"%s\":{\"_index\":\"%s\"}}", w.action, w.index[0])
+			w.index = nil
+		}
+	} else if w.group != "" {
+		w.prefix = fmt.Sprintf("{\"%s\":{\"_index\":\"%s.%s\"}}", w.action, w.group, w.config.Name)
 	} else {
-		w.prefix = fmt.Sprintf("{\"index\":{\"_index\":\"%s\"}}", w.config.Name)
+		w.prefix = fmt.Sprintf("{\"%s\":{\"_index\":\"%s\"}}", w.action, w.config.Name)
 	}
 
 	return w
 }
 
+var logTimeKeys = [][]byte{[]byte("\"logTime\":"), []byte("\"LogTime\":")}
+
+// getLogTime 从日志数据中读取日志时间，读取失败时使用当前时间
+func getLogTime(data []byte) time.Time {
+	for _, key := range logTimeKeys {
+		pos := bytes.Index(data, key)
+		if pos == -1 {
+			continue
+		}
+		v := data[pos+len(key):]
+		if len(v) > 0 && v[0] == '"' {
+			if end := bytes.IndexByte(v[1:], '"'); end != -1 {
+				if tm := MakeTime(string(v[1 : end+1])); !tm.IsZero() {
+					return tm
+				}
+			}
+		} else if end := bytes.IndexAny(v, ",}"); end > 0 {
+			// 兼容以秒为单位的数字时间
+			if ft := u.Float64(string(v[0:end])); ft > 0 {
+				return time.Unix(0, int64(ft*1e9))
+			}
+		}
+	}
+	return time.Now()
+}
+
+// makeIndex 根据日志时间生成索引名
+func (w *esWriter) makeIndex(tm time.Time) string {
+	index := w.index[0]
+	for i := 1; i < len(w.index); i += 2 {
+		index += tm.Format(w.index[i]) + w.index[i+1]
+	}
+	return index
+}
+
 func (w *esWriter) Log(data []byte) {
 	l := len(data)
 	if data == nil || l == 0 {
 		return
 	}
+	prefix := w.prefix
+	if w.index != nil || w.dataStream {
+		tm := getLogTime(data)
+		if w.index != nil {
+			prefix = fmt.Sprintf("{\"%s\":{\"_index\":\"%s\"}}", w.action, w.makeIndex(tm))
+		}
+		if w.dataStream && l > 2 && data[0] == '{' {
+			// 数据流要求每条数据都有 @timestamp
+			data = append([]byte("{\"@timestamp\":\""+MakeLogTime(tm)+"\","), data[1:]...)
+		}
+	}
 	dataString := string(data)
 
 	// 将数据加入队列
 	w.lock.Lock()
-	w.queue = append(w.queue, w.prefix, dataString)
+	w.queue = append(w.queue, prefix, dataString)
 	w.lock.Unlock()
 }
 
 var responseOkString = []byte("\"errors\":false")
 
+// Run 由写入队列在累计足够的数据或等待超时后调用，发送队列中的数据并重放暂存的数据
 func (w *esWriter) Run() {
-	now := time.Now().Unix()
-	// 超过100条数据 或 过了1秒 发送数据（1秒内不超过100条不发送）
-	if len(w.queue) > 100 || (len(w.queue) > 0 && (now > w.last || !writerRunning)) {
-		var sendings []string
-		w.lock.Lock()
-		sendings = w.queue
-		w.queue = make([]string, 0)
-		w.lock.Unlock()
+	_, _ = w.flush(context.Background())
+}
+
+// Flush 按期限发送队列中的数据，返回发送失败且无法暂存的日志数量
+func (w *esWriter) Flush(ctx context.Context) (int, error) {
+	return w.flush(ctx)
+}
 
+// Close 按期限发送队列中的数据，等待重试的数据计为丢失
+func (w *esWriter) Close(ctx context.Context) (int, error) {
+	w.nextRetry = time.Time{}
+	lost, err := w.flush(ctx)
+	lost += len(w.retries)
+	w.retries = nil
+	return lost, err
+}
+
+func (w *esWriter) flush(ctx context.Context) (lost int, err error) {
+	var sendings []string
+	w.lock.Lock()
+	sendings = w.queue
+	w.queue = make([]string, 0)
+	w.lock.Unlock()
+
+	// 没有暂存目录时，到达重试时间后等待重试的数据放在最前面随这一批数据发送
+	times := make([]int, 0, len(w.retries)+len(sendings)/2)
+	if len(w.retries) > 0 && !time.Now().Before(w.nextRetry) {
+		lines := make([]string, 0, len(w.retries)*2+len(sendings))
+		for _, item := range w.retries {
+			lines = append(lines, item.action, item.doc)
+			times = append(times, item.times)
+		}
+		sendings = append(lines, sendings...)
+		w.retries = nil
+	}
+	for len(times) < len(sendings)/2 {
+		times = append(times, 0)
+	}
+
+	if len(sendings) > 0 {
 		data := strings.Join(sendings, "\n") + "\n"
-		req, err := http.NewRequest("POST", w.url, bytes.NewReader([]byte(data)))
-		if err != nil {
-			log.Println("es sent failed", err.Error(), data)
-			return
+		if len(w.spoolFiles) > 0 {
+			// 存在未重放的数据时直接暂存，保证发送顺序
+			if !w.spoolWrite(data) {
+				lost = len(sendings) / 2
+			}
+		} else if res, retry, sendErr := w.send(ctx, data); sendErr != nil {
+			if retry && w.spool != "" && w.spoolWrite(data) {
+				w.delayRetry()
+			} else {
+				log.Println("es sent failed", sendErr.Error(), data)
+				lost = len(sendings) / 2
+				err = sendErr
+			}
+		} else if retryIndexes := w.checkItems(sendings, res); len(retryIndexes) > 0 {
+			lost += w.retryItems(sendings, times, retryIndexes)
+		} else if len(w.retries) == 0 {
+			w.backoff = 0
 		}
+	}
+
+	if len(w.spoolFiles) > 0 && !time.Now().Before(w.nextRetry) && ctx.Err() == nil {
+		lost += w.replay(ctx)
+	}
+	lost += w.spoolDropped
+	w.spoolDropped = 0
+	return lost, err
+}
 
-		req.Header.Set("Content-Type", "application/json")
-		if w.user != "" {
-			req.SetBasicAuth(w.user, w.password)
+// retryItems 将 es 返回 429、503 的数据按指数退避等待重新发送，超过重试次数或数量上限的数据丢弃，返回丢弃的数量
+func (w *esWriter) retryItems(lines []string, times []int, indexes []int) (dropped int) {
+	if w.spool != "" {
+		// 暂存为第一个暂存文件，在之后的数据之前重放
+		retries := make([]string, 0, len(indexes)*2)
+		for _, i := range indexes {
+			retries = append(retries, lines[i*2], lines[i*2+1])
 		}
+		if w.itemRetry <= 0 || !w.spoolWrite(strings.Join(retries, "\n")+"\n") {
+			log.Println("es dropped", len(indexes), "items after retry")
+			return len(indexes)
+		}
+		w.spoolRetry = 1
+		w.delayRetry()
+		return 0
+	}
 
-		res, err := w.client.Do(req)
-		if err != nil {
-			log.Println("es sent failed", err.Error(), data)
-			return
+	for _, i := range indexes {
+		if times[i] >= w.itemRetry || len(w.retries) >= w.retryMaxItems {
+			dropped++
+			continue
+		}
+		w.retries = append(w.retries, esRetryItem{action: lines[i*2], doc: lines[i*2+1], times: times[i] + 1})
+	}
+	if dropped > 0 {
+		log.Println("es dropped", dropped, "items after retry")
+	}
+	if len(w.retries) > 0 {
+		w.delayRetry()
+	}
+	return dropped
+}
+
+// NextWakeup 存在暂存或等待重试的数据时在下一次重试的时间唤醒
+func (w *esWriter) NextWakeup() time.Duration {
+	if len(w.spoolFiles) > 0 || len(w.retries) > 0 {
+		d := time.Until(w.nextRetry)
+		if d <= 0 {
+			d = time.Millisecond
+		}
+		return d
+	}
+	return 0
+}
+
+// send 发送一批数据，返回的 retry 表示失败后是否可以重试，部分数据写入失败时返回 es 的响应
+func (w *esWriter) send(ctx context.Context, data string) (bulkRes *esBulkResponse, retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url, bytes.NewReader([]byte(data)))
+	if err != nil {
+		return nil, false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if w.user != "" {
+		req.SetBasicAuth(w.user, w.password)
+	}
+
+	res, err := w.client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+
+	result, err := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if err != nil {
+		return nil, true, err
+	}
+
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		return nil, true, fmt.Errorf("%s %s", res.Status, string(result))
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, false, fmt.Errorf("%s %s", res.Status, string(result))
+	}
+	if bytes.Index(result, responseOkString) != -1 {
+		return nil, false, nil
+	}
+
+	bulkRes = new(esBulkResponse)
+	if err := json.Unmarshal(result, bulkRes); err != nil {
+		return nil, false, errors.New(string(result))
+	}
+	return bulkRes, false, nil
+}
+
+// checkItems 逐条检查 es 的处理结果，被拒绝的数据写入死信，返回 429、503 需要重新发送的数据的序号
+func (w *esWriter) checkItems(lines []string, res *esBulkResponse) []int {
+	retries := make([]int, 0)
+	if res == nil {
+		return retries
+	}
+	for i, item := range res.Items {
+		if i*2+1 >= len(lines) {
+			break
+		}
+		for _, r := range item {
+			if r.Status >= 200 && r.Status <= 299 {
+				continue
+			}
+			if r.Status == http.StatusTooManyRequests || r.Status == http.StatusServiceUnavailable {
+				retries = append(retries, i)
+			} else {
+				w.reject(lines[i*2], lines[i*2+1], r)
+			}
 		}
+	}
+	return retries
+}
 
-		result, err := ioutil.ReadAll(res.Body)
+// reject 将被 es 拒绝的数据连同错误原因写入死信文件
+func (w *esWriter) reject(action, doc string, r esBulkItem) {
+	errorType, reason := "", ""
+	if r.Error != nil {
+		errorType = r.Error.Type
+		reason = r.Error.Reason
+	}
+	if w.deadLetter == "" {
+		log.Println("es rejected", r.Status, errorType, reason, doc)
+		return
+	}
+
+	line, _ := json.Marshal(map[string]interface{}{
+		"logTime":   MakeLogTime(time.Now()),
+		"status":    r.Status,
+		"errorType": errorType,
+		"reason":    reason,
+		"action":    json.RawMessage(action),
+		"doc":       json.RawMessage(doc),
+	})
+	fp, err := os.OpenFile(w.deadLetter, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Println("es rejected", r.Status, errorType, reason, doc)
+		return
+	}
+	_, _ = fp.Write(append(line, '\n'))
+	_ = fp.Close()
+}
+
+// delayRetry 按指数退避推迟下一次重试
+func (w *esWriter) delayRetry() {
+	if w.backoff <= 0 {
+		w.backoff = time.Second
+	} else {
+		w.backoff *= 2
+	}
+	if w.backoff > w.retryMax {
+		w.backoff = w.retryMax
+	}
+	w.nextRetry = time.Now().Add(w.backoff)
+}
+
+// replay 按写入顺序重新发送暂存的数据，遇到可重试的错误时停止等待下一次重试，
+// 被 es 限流的数据写回第一个暂存文件，超过重试次数时丢弃，返回丢弃的数量
+func (w *esWriter) replay(ctx context.Context) (dropped int) {
+	for i := 0; i < 10 && len(w.spoolFiles) > 0; i++ {
+		fileName := w.spoolFiles[0]
+		data, err := ioutil.ReadFile(fileName)
+		var res *esBulkResponse
+		if err == nil {
+			var retry bool
+			res, retry, err = w.send(ctx, string(data))
+			if err != nil {
+				if retry {
+					w.delayRetry()
+					return dropped
+				}
+				log.Println("es sent failed", err.Error(), string(data))
+			}
+		}
 		if err != nil {
-			log.Println("es sent failed", err.Error(), data)
-			return
+			// 读取失败或不可重试的错误，整批丢弃
+			dropped += bytes.Count(data, []byte{'\n'}) / 2
+		}
+
+		lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		if retryIndexes := w.checkItems(lines, res); len(retryIndexes) > 0 {
+			if w.spoolRetry < w.itemRetry {
+				retries := make([]string, 0, len(retryIndexes)*2)
+				for _, i := range retryIndexes {
+					retries = append(retries, lines[i*2], lines[i*2+1])
+				}
+				if w.spoolRewrite(strings.Join(retries, "\n") + "\n") {
+					w.spoolRetry++
+					w.delayRetry()
+					return dropped
+				}
+			}
+			log.Println("es dropped", len(retryIndexes), "items after retry")
+			dropped += len(retryIndexes)
+		}
+		w.spoolRemove()
+	}
+	w.backoff = 0
+	return dropped
+}
+
+// loadSpool 加载上次运行时遗留的暂存文件
+func (w *esWriter) loadSpool() error {
+	if err := os.MkdirAll(w.spool, 0755); err != nil {
+		return err
+	}
+	matches, err := filepath.Glob(filepath.Join(w.spool, "*.bulk"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+	for _, m := range matches {
+		if info, err := os.Stat(m); err == nil {
+			w.spoolFiles = append(w.spoolFiles, m)
+			w.spoolSize += info.Size()
+			if seq := u.Int64(strings.TrimSuffix(filepath.Base(m), ".bulk")); seq > w.spoolSeq {
+				w.spoolSeq = seq
+			}
 		}
-		_ = res.Body.Close()
+	}
+	return nil
+}
 
-		if bytes.Index(result, responseOkString) == -1 {
-			log.Println("es sent failed", string(result), data)
+// spoolWrite 将数据写入暂存目录，超出尺寸上限时丢弃最早的数据，返回是否写入成功
+func (w *esWriter) spoolWrite(data string) bool {
+	dropped := 0
+	for len(w.spoolFiles) > 0 && w.spoolSize+int64(len(data)) > w.spoolMax {
+		if buf, err := ioutil.ReadFile(w.spoolFiles[0]); err == nil {
+			w.spoolDropped += bytes.Count(buf, []byte{'\n'}) / 2
 		}
-		w.last = now
+		w.spoolRemove()
+		dropped++
+	}
+	if dropped > 0 {
+		log.Println("es spool is full, dropped", dropped, "batches")
+	}
+
+	seq := time.Now().UnixNano()
+	if seq <= w.spoolSeq {
+		seq = w.spoolSeq + 1
+	}
+	w.spoolSeq = seq
+	fileName := filepath.Join(w.spool, fmt.Sprintf("%020d.bulk", seq))
+	if err := ioutil.WriteFile(fileName, []byte(data), 0644); err != nil {
+		log.Println("es spool failed", err.Error(), data)
+		return false
+	}
+	w.spoolFiles = append(w.spoolFiles, fileName)
+	w.spoolSize += int64(len(data))
+	return true
+}
+
+// spoolRewrite 使用需要重试的数据替换第一个暂存文件的内容，使其在之后的数据之前重放
+func (w *esWriter) spoolRewrite(data string) bool {
+	fileName := w.spoolFiles[0]
+	oldSize := int64(0)
+	if info, err := os.Stat(fileName); err == nil {
+		oldSize = info.Size()
+	}
+	if err := ioutil.WriteFile(fileName, []byte(data), 0644); err != nil {
+		log.Println("es spool failed", err.Error(), data)
+		return false
+	}
+	w.spoolSize += int64(len(data)) - oldSize
+	return true
+}
+
+// spoolRemove 删除最早的一个暂存文件
+func (w *esWriter) spoolRemove() {
+	w.spoolRetry = 0
+	fileName := w.spoolFiles[0]
+	if info, err := os.Stat(fileName); err == nil {
+		w.spoolSize -= info.Size()
 	}
+	_ = os.Remove(fileName)
+	w.spoolFiles = w.spoolFiles[1:]
 }
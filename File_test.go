@@ -0,0 +1,64 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ssgo/standard"
+)
+
+func TestFileOutOfOrderSplit(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "tmp_test_order.Log")
+	f := &File{fileName: fileName, splitTag: "2006010215", lock: sync.Mutex{}, compress: "gzip"}
+	splitA := time.Date(2021, 3, 4, 10, 59, 59, 0, time.Local)
+	splitB := splitA.Add(2 * time.Second)
+
+	// 跨越切割周期时乱序到达的日志写入当前文件，不重新打开之前的文件
+	f.write(Log{time: splitA, data: []byte(`{"info":"a1"}`)})
+	f.write(Log{time: splitB, data: []byte(`{"info":"b1"}`)})
+	f.write(Log{time: splitA.Add(500 * time.Millisecond), data: []byte(`{"info":"a2"}`)})
+	f.write(Log{time: splitB.Add(time.Millisecond), data: []byte(`{"info":"b2"}`)})
+	f.Run()
+	time.Sleep(100 * time.Millisecond)
+	f.cleanLock.Lock()
+	f.cleanLock.Unlock()
+	f.Close()
+
+	fileA := fileName + "." + splitA.Format(f.splitTag)
+	fileB := fileName + "." + splitB.Format(f.splitTag)
+	if _, err := os.Stat(fileA); err == nil {
+		t.Error("split reopened test failed", fileA)
+	}
+	if _, err := os.Stat(fileB + ".gz"); err == nil {
+		t.Error("current split compressed test failed", fileB)
+	}
+	buf, _ := os.ReadFile(fileB)
+	if lines := strings.Split(strings.TrimSpace(string(buf)), "\n"); len(lines) != 3 || !strings.Contains(lines[1], `"a2"`) {
+		t.Error("out of order log test failed", lines)
+	}
+	n := 0
+	_ = ParseLogFile(fileA+".gz", func(baseLog *standard.BaseLog) {
+		n++
+	})
+	if n != 1 {
+		t.Error("compressed split test failed", n)
+	}
+}
+
+func TestFileOpenCompacting(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "tmp_test_compacting.Log")
+	f := &File{fileName: fileName, splitTag: "20060102", lock: sync.Mutex{}}
+	f.lastSplit = "20210304"
+	f.compacts = map[string]bool{fileName + ".20210304": true}
+
+	// 等待压缩的文件不能被重新打开
+	f.open()
+	f.Close()
+	if f.current != fileName+".20210304.1" {
+		t.Error("open compacting file test failed", f.current)
+	}
+}
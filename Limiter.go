@@ -0,0 +1,186 @@
+package log
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ssgo/standard"
+	"github.com/ssgo/u"
+)
+
+// limiter 按 logType 和消息采样，并使用令牌桶限制日志的总数量，被抑制的日志数量在周期结束时汇总输出
+type limiter struct {
+	interval   time.Duration
+	first      int
+	thereafter int
+	rate       float64
+	burst      float64
+	tokens     float64
+	lastTime   time.Time
+	window     time.Time
+	counts     map[string]int
+	sampled    uint64
+	limited    uint64
+	timer      *time.Timer
+	report     func(sampled, limited uint64)
+	lock       sync.Mutex
+}
+
+func newLimiter(conf *Config) *limiter {
+	if conf.SampleFirst <= 0 && conf.RateLimit <= 0 {
+		return nil
+	}
+	l := &limiter{
+		interval:   time.Second,
+		first:      conf.SampleFirst,
+		thereafter: conf.SampleThereafter,
+		rate:       float64(conf.RateLimit),
+		burst:      float64(conf.RateBurst),
+		counts:     map[string]int{},
+	}
+	if conf.SampleInterval != "" {
+		if d := parseDuration(conf.SampleInterval); d > 0 {
+			l.interval = d
+		}
+	}
+	if l.burst <= 0 {
+		l.burst = l.rate
+	}
+	l.tokens = l.burst
+	return l
+}
+
+// allow 判断日志是否需要记录，key 为空时不进行采样
+func (l *limiter) allow(key string) bool {
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.first > 0 && key != "" {
+		if now.Sub(l.window) >= l.interval {
+			l.window = now
+			l.counts = map[string]int{}
+		}
+		n := l.counts[key] + 1
+		l.counts[key] = n
+		if n > l.first && (l.thereafter <= 0 || (n-l.first)%l.thereafter != 0) {
+			l.sampled++
+			l.schedule()
+			return false
+		}
+	}
+
+	if l.rate > 0 {
+		if !l.lastTime.IsZero() {
+			l.tokens += now.Sub(l.lastTime).Seconds() * l.rate
+			if l.tokens > l.burst {
+				l.tokens = l.burst
+			}
+		}
+		l.lastTime = now
+		if l.tokens < 1 {
+			l.limited++
+			l.schedule()
+			return false
+		}
+		l.tokens--
+	}
+	return true
+}
+
+// schedule 在周期结束时输出汇总日志
+func (l *limiter) schedule() {
+	if l.timer == nil {
+		l.timer = time.AfterFunc(l.interval, l.flush)
+	}
+}
+
+// flush 立即输出汇总日志
+func (l *limiter) flush() {
+	l.lock.Lock()
+	sampled := l.sampled
+	limited := l.limited
+	l.sampled = 0
+	l.limited = 0
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.lock.Unlock()
+	if (sampled > 0 || limited > 0) && l.report != nil {
+		l.report(sampled, limited)
+	}
+}
+
+// getLogKey 返回用于采样的 logType 和消息，不包含消息的日志返回空字符串
+func getLogKey(data interface{}) string {
+	logType := ""
+	message := ""
+	switch v := data.(type) {
+	case standard.ErrorLog:
+		logType, message = v.LogType, v.Error
+	case *standard.ErrorLog:
+		logType, message = v.LogType, v.Error
+	case standard.WarningLog:
+		logType, message = v.LogType, v.Warning
+	case *standard.WarningLog:
+		logType, message = v.LogType, v.Warning
+	case standard.InfoLog:
+		logType, message = v.LogType, v.Info
+	case *standard.InfoLog:
+		logType, message = v.LogType, v.Info
+	case standard.DebugLog:
+		logType, message = v.LogType, v.Debug
+	case *standard.DebugLog:
+		logType, message = v.LogType, v.Debug
+	case standard.DBErrorLog:
+		logType, message = v.ErrorLog.LogType, v.Error
+	case *standard.DBErrorLog:
+		logType, message = v.ErrorLog.LogType, v.Error
+	case standard.ServerErrorLog:
+		logType, message = v.LogType, v.Error
+	case *standard.ServerErrorLog:
+		logType, message = v.LogType, v.Error
+	case map[string]interface{}:
+		for _, k := range []string{"error", "warning", "info", "debug"} {
+			if m, ok := v[k]; ok {
+				logType, message = u.String(v["logType"]), u.String(m)
+				break
+			}
+		}
+	}
+	if message == "" {
+		return ""
+	}
+	return logType + "\n" + message
+}
+
+// checkLimit 在获取调用栈和生成日志之前按 logType 和消息进行采样和限流，
+// 开启去重时需要先去重再采样，由 Log 处理
+func (logger *Logger) checkLimit(logType, message string) bool {
+	if logger.limiter == nil || logger.deduper != nil {
+		return true
+	}
+	key := ""
+	if message != "" {
+		key = logType + "\n" + message
+	}
+	return logger.limiter.allow(key)
+}
+
+// logLimited 写出已经通过 checkLimit 的日志
+func (logger *Logger) logLimited(data interface{}) {
+	if logger.deduper != nil {
+		logger.Log(data)
+		return
+	}
+	logger.log(data, "")
+}
+
+func (logger *Logger) reportSuppressed(sampled, limited uint64) {
+	logger.log(standard.WarningLog{
+		BaseLog: logger.MakeBaseLog(standard.LogTypeWarning, "sampled", sampled, "rateLimited", limited),
+		Warning: fmt.Sprintf("suppressed %d logs", sampled+limited),
+	}, "")
+}
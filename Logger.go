@@ -1,19 +1,24 @@
 package log
 
 import (
+	"bufio"
 	"bytes"
-	"container/list"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ssgo/standard"
@@ -29,8 +34,9 @@ const ERROR LevelType = 4
 const CLOSE LevelType = 5
 
 type Log struct {
-	time    time.Time
-	message string
+	time  time.Time
+	level LevelType
+	data  []byte
 }
 
 type File struct {
@@ -38,61 +44,240 @@ type File struct {
 	lastSplit string
 	splitTag  string
 	fp        *os.File
-	list      *list.List
+	buf       *bufio.Writer
+	queue     *writerQueue
 	lock      sync.Mutex
+	maxSize   int64
+	maxFiles  int
+	maxAge    time.Duration
+	size      int64
+	index     int
+	compress  string
+	current   string
+	lastTime  time.Time       // 已写入日志的最晚时间，早于它的日志不会切换回之前的切割周期
+	compacts  map[string]bool // 等待压缩的文件，不能重新打开
+	cleanLock sync.Mutex
 }
 
 func (f *File) Write(tm time.Time, str string) {
-	f.lock.Lock()
-	f.list.PushBack(Log{
-		time:    tm,
-		message: str,
+	f.queue.put(Log{
+		time: tm,
+		data: []byte(str),
 	})
-	f.lock.Unlock()
 }
 
+// write 由写入队列调用，写入缓冲区并按切割周期和尺寸切换文件
+func (f *File) write(l Log) {
+	logStr := l.time.Format("2006/01/02 15:04:05.000000") + " " + string(l.data) + "\n"
+	nowSplit := l.time.Format(f.splitTag)
+	if f.fp != nil && l.time.Before(f.lastTime) {
+		// 并发写入时日志可能乱序到达，只向后切换，较早的日志写入当前文件
+		nowSplit = f.lastSplit
+	} else {
+		f.lastTime = l.time
+	}
+	if f.lastSplit != nowSplit || f.fp == nil {
+		// 切换到新的切割周期，延续该周期内已存在的最后一个分段
+		f.lastSplit = nowSplit
+		f.index = f.lastIndex(nowSplit)
+		f.open()
+	} else if f.maxSize > 0 && f.size > 0 && f.size+int64(len(logStr)) > f.maxSize {
+		// 超过文件尺寸上限，滚动到下一个编号的分段
+		f.index++
+		f.open()
+	}
+	var err error
+	if f.buf != nil {
+		_, err = f.buf.WriteString(logStr)
+	} else {
+		err = os.ErrInvalid
+	}
+	if err != nil {
+		fmt.Println(Viewable(logStr))
+	} else {
+		f.size += int64(len(logStr))
+	}
+}
+
+// Run 将缓冲区中的日志写入文件
 func (f *File) Run() {
 	f.lock.Lock()
-	var runList *list.List = nil
-	if f.list.Len() > 0 {
-		runList = f.list
-		f.list = list.New()
+	if f.buf != nil {
+		if err := f.buf.Flush(); err != nil {
+			log.Println(u.BRed(err.Error()))
+		}
 	}
 	f.lock.Unlock()
+}
 
-	if runList != nil {
-		for i := runList.Front(); i != nil; i = i.Next() {
-			if l, ok := i.Value.(Log); ok {
-				nowSplit := l.time.Format(f.splitTag)
-				if f.lastSplit != nowSplit || f.fp == nil {
-					f.lastSplit = nowSplit
-					var err error
-					f.lock.Lock()
-					if f.fp != nil {
-						_ = f.fp.Close()
-					}
-					f.fp, err = os.OpenFile(f.fileName+"."+nowSplit, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
-					f.lock.Unlock()
-					if err != nil {
-					}
+// fileBase 返回切割周期对应的文件名（不含分段编号）
+func (f *File) fileBase(split string) string {
+	if split == "" {
+		return f.fileName
+	}
+	return f.fileName + "." + split
+}
+
+// segmentName 返回当前切割周期和分段编号对应的文件名，第0段不带编号
+func (f *File) segmentName() string {
+	if f.index > 0 {
+		return f.fileBase(f.lastSplit) + "." + strconv.Itoa(f.index)
+	}
+	return f.fileBase(f.lastSplit)
+}
+
+// lastIndex 查找切割周期内已存在的最大分段编号，用于进程重启后继续写入
+func (f *File) lastIndex(split string) int {
+	if f.maxSize <= 0 {
+		return 0
+	}
+	base := f.fileBase(split) + "."
+	matches, _ := filepath.Glob(base + "*")
+	index := 0
+	for _, m := range matches {
+		seg := strings.TrimSuffix(m[len(base):], compressExt(m))
+		if n, err := strconv.Atoi(seg); err == nil && n > index {
+			index = n
+		}
+	}
+	return index
+}
+
+func (f *File) open() {
+	f.lock.Lock()
+	fileName := f.segmentName()
+	for f.compacts[fileName] {
+		// 文件正在等待压缩并会被删除，使用下一个编号的分段
+		f.index++
+		fileName = f.segmentName()
+	}
+	if f.fp != nil {
+		_ = f.buf.Flush()
+		_ = f.fp.Close()
+	}
+	var err error
+	f.fp, err = os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	f.size = 0
+	if err == nil {
+		f.buf = bufio.NewWriterSize(f.fp, 64*1024)
+		if info, err := f.fp.Stat(); err == nil {
+			f.size = info.Size()
+		}
+	} else {
+		f.fp = nil
+		f.buf = nil
+		log.Println(u.BRed(err.Error()))
+	}
+	prevName := f.current
+	f.current = fileName
+	if prevName == fileName {
+		prevName = ""
+	}
+	if prevName != "" && f.compress != "" {
+		if f.compacts == nil {
+			f.compacts = map[string]bool{}
+		}
+		f.compacts[prevName] = true
+	}
+	f.lock.Unlock()
+
+	if (prevName != "" && f.compress != "") || f.maxFiles > 0 || f.maxAge > 0 {
+		go func() {
+			// 压缩和清理在后台依次进行，避免与写入争抢
+			f.cleanLock.Lock()
+			defer f.cleanLock.Unlock()
+			if prevName != "" && f.compress != "" {
+				if err := compressFile(prevName, f.compress); err != nil {
+					log.Println(u.BRed(err.Error()))
 				}
-				logStr := l.time.Format("2006/01/02 15:04:05.000000") + " " + l.message + "\n"
 				f.lock.Lock()
-				_, err := f.fp.WriteString(logStr)
+				delete(f.compacts, prevName)
 				f.lock.Unlock()
-				if err != nil {
-					fmt.Println(Viewable(logStr))
-				}
 			}
+			if f.maxFiles > 0 || f.maxAge > 0 {
+				f.prune()
+			}
+		}()
+	}
+}
+
+// prune 清理超出保留数量或保留时间的历史日志文件
+func (f *File) prune() {
+	f.lock.Lock()
+	current := f.current
+	f.lock.Unlock()
+	matches, err := filepath.Glob(f.fileName + ".*")
+	if err != nil {
+		return
+	}
+	type oldFile struct {
+		name    string
+		modTime time.Time
+	}
+	olds := make([]oldFile, 0)
+	for _, m := range matches {
+		if m == current || !f.isOwnFile(m) {
+			continue
+		}
+		info, err := os.Stat(m)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		olds = append(olds, oldFile{name: m, modTime: info.ModTime()})
+	}
+	sort.Slice(olds, func(i, j int) bool {
+		if olds[i].modTime.Equal(olds[j].modTime) {
+			// 修改时间相同时编号大的分段更新
+			if len(olds[i].name) != len(olds[j].name) {
+				return len(olds[i].name) > len(olds[j].name)
+			}
+			return olds[i].name > olds[j].name
+		}
+		return olds[i].modTime.After(olds[j].modTime)
+	})
+
+	now := time.Now()
+	for i, old := range olds {
+		if (f.maxFiles > 0 && i >= f.maxFiles) || (f.maxAge > 0 && now.Sub(old.modTime) > f.maxAge) {
+			_ = os.Remove(old.name)
 		}
 	}
 }
 
+// isOwnFile 判断是否为当前写入器生成的文件，格式为 文件名.切割周期[.分段编号][.gz|.zst]，
+// 避免清理使用相同文件名、不同切割周期的其他写入器的文件或无关文件
+func (f *File) isOwnFile(name string) bool {
+	if !strings.HasPrefix(name, f.fileName+".") {
+		return false
+	}
+	rest := strings.TrimSuffix(name[len(f.fileName)+1:], compressExt(name))
+	if f.splitTag == "" {
+		n, err := strconv.Atoi(rest)
+		return err == nil && n > 0
+	}
+	if f.isSplitName(rest) {
+		return true
+	}
+	if pos := strings.LastIndexByte(rest, '.'); pos > 0 {
+		n, err := strconv.Atoi(rest[pos+1:])
+		return err == nil && n > 0 && f.isSplitName(rest[0:pos])
+	}
+	return false
+}
+
+// isSplitName 判断是否为按切割周期格式化的时间
+func (f *File) isSplitName(s string) bool {
+	tm, err := time.ParseInLocation(f.splitTag, s, time.Local)
+	return err == nil && tm.Format(f.splitTag) == s
+}
+
 func (f *File) Close() {
 	f.lock.Lock()
 	if f.fp != nil {
+		_ = f.buf.Flush()
 		_ = f.fp.Close()
 		f.fp = nil
+		f.buf = nil
 	}
 	f.lock.Unlock()
 }
@@ -107,25 +292,46 @@ type Logger struct {
 	//fp              *os.File
 	file            *File
 	writer          Writer
+	queue           *writerQueue
 	truncations     []string
 	sensitive       map[string]bool
 	regexSensitive  []*regexp.Regexp
 	sensitiveRule   []sensitiveRuleInfo
 	desensitization func(string) string
 	traceId         string
+	spanId          string
+	traceState      string
+	traceFlags      byte
+	fields          map[string]interface{}
+	limiter         *limiter
+	deduper         *deduper
 }
 
 type Config struct {
-	Name           string
-	Level          string
-	File           string
-	Fast           bool
-	SplitTag       string
-	Truncations    string
-	Sensitive      string
-	RegexSensitive string
-	SensitiveRule  string
-	KeepKeyCase    bool // 是否保持Key的首字母大小写？默认一律使用小写
+	Name             string
+	Level            string
+	File             string
+	Fast             bool
+	SplitTag         string
+	Truncations      string
+	Sensitive        string
+	RegexSensitive   string
+	SensitiveRule    string
+	KeepKeyCase      bool   // 是否保持Key的首字母大小写？默认一律使用小写
+	QueueSize        int    // 写入队列的最大长度，默认 10000
+	FlushSize        int    // 队列中累计多少条日志后立即写出，默认 100
+	FlushInterval    string // 有日志等待写出时的最长等待时间，默认文件在队列为空时立即写出，其他 Writer 为 1s
+	QueuePolicy      string // 队列满时的处理策略：dropNewest（默认）、dropOldest、dropLevel、block
+	MaxSize          string // 单个日志文件的最大尺寸，如 100M，超过后在同一切割周期内滚动到编号分段（name.tag.1、name.tag.2 ...）
+	MaxFiles         int    // 最多保留的历史日志文件数量，0 表示不限制
+	MaxAge           string // 历史日志文件的最长保留时间，如 7d、72h，0 表示不限制
+	Compress         string // 历史日志文件的压缩方式，gzip 或 zstd，切换到新文件后在后台压缩为 .gz 或 .zst
+	SampleFirst      int    // 每个采样周期内相同 logType 和消息的日志只记录前 N 条，0 表示不采样
+	SampleThereafter int    // 超过 SampleFirst 后每 M 条记录 1 条，0 表示不再记录
+	SampleInterval   string // 采样周期，也是输出抑制汇总日志的周期，默认 1s
+	RateLimit        int    // 每秒最多记录的日志数量（令牌桶），0 表示不限制
+	RateBurst        int    // 令牌桶的容量，默认等于 RateLimit
+	Dedup            string // 合并重复日志的窗口，如 10s，窗口内连续相同（logType、消息和调用栈）的日志合并为一条并记录 repeated、firstTime、lastTime，空表示不合并
 }
 
 type sensitiveRuleInfo struct {
@@ -270,14 +476,26 @@ func NewLogger(conf Config) *Logger {
 				w := writerMakers[writerName](&conf)
 				if w != nil {
 					logger.writer = w
-					writers = append(writers, w)
+					logger.queue = newWriterQueue(&conf, time.Second)
+					logger.queue.write = func(l Log) {
+						w.Log(l.data)
+					}
+					logger.queue.flush = w.Run
+					if ww, ok := w.(WakeupWriter); ok {
+						logger.queue.wakeup = ww.NextWakeup
+					}
+					if fw, ok := w.(FlushWriter); ok {
+						logger.queue.flushContext = fw.Flush
+						logger.queue.closeContext = fw.Close
+					}
+					addQueue(logger.queue)
 				}
 				CheckStart() // keep writer running
 			} else {
 				logger.Error("unsupported logger writer "+writerName, "file", conf.File)
 			}
 		} else {
-			if conf.SplitTag != "" {
+			if conf.SplitTag != "" || conf.MaxSize != "" {
 				filesLock.RLock()
 				logger.file = files[conf.File+conf.SplitTag]
 				filesLock.RUnlock()
@@ -288,13 +506,22 @@ func NewLogger(conf Config) *Logger {
 						lastSplit: "",
 						splitTag:  conf.SplitTag,
 						fp:        nil,
-						list:      list.New(),
 						lock:      sync.Mutex{},
+						maxSize:   ParseSize(conf.MaxSize),
+						maxFiles:  conf.MaxFiles,
+						maxAge:    parseDuration(conf.MaxAge),
+						compress:  strings.ToLower(conf.Compress),
 					}
+					logger.file.queue = newWriterQueue(&conf, 0)
+					logger.file.queue.write = logger.file.write
+					logger.file.queue.flush = logger.file.Run
+					logger.file.queue.close = logger.file.Close
 					filesLock.Lock()
 					files[conf.File+conf.SplitTag] = logger.file
 					filesLock.Unlock()
+					addQueue(logger.file.queue)
 				}
+				logger.queue = logger.file.queue
 				CheckStart() // keep writer running
 			} else {
 				fp, err := os.OpenFile(conf.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -319,6 +546,12 @@ func NewLogger(conf Config) *Logger {
 		}
 	}
 	logger.config = conf
+	logger.deduper = newDeduper(&conf)
+	logger.limiter = newLimiter(&conf)
+	if logger.limiter != nil {
+		rootLogger := &logger
+		logger.limiter.report = rootLogger.reportSuppressed
+	}
 	return &logger
 }
 
@@ -354,16 +587,83 @@ func (logger *Logger) SetDesensitization(f func(v string) string) {
 	logger.desensitization = f
 }
 
+// New 返回使用新 traceId 的子 Logger，不延续原链路的 spanId、tracestate 和采样标记
 func (logger *Logger) New(traceId string) *Logger {
 	newLogger := *logger
 	newLogger.traceId = traceId
+	newLogger.spanId = ""
+	newLogger.traceState = ""
+	newLogger.traceFlags = 0
 	return &newLogger
 }
 
+// With 返回绑定了字段的子 Logger，字段会合并到之后每一条日志的 Extra 中，后设置的同名字段会覆盖之前的
+func (logger *Logger) With(keyAndValues ...interface{}) *Logger {
+	newLogger := *logger
+	newLogger.fields = make(map[string]interface{}, len(logger.fields)+len(keyAndValues)/2)
+	for k, v := range logger.fields {
+		newLogger.fields[k] = v
+	}
+	if len(keyAndValues) == 1 {
+		if mapData, ok := keyAndValues[0].(map[string]interface{}); ok {
+			for k, v := range mapData {
+				newLogger.fields[k] = v
+			}
+		}
+	}
+	for i := 1; i < len(keyAndValues); i += 2 {
+		if k, ok := keyAndValues[i-1].(string); ok {
+			newLogger.fields[k] = keyAndValues[i]
+		}
+	}
+	return &newLogger
+}
+
+// GetFields 返回通过 With 绑定的字段
+func (logger *Logger) GetFields() map[string]interface{} {
+	return logger.fields
+}
+
 func (logger *Logger) GetTraceId() string {
 	return logger.traceId
 }
 
+// Flush 写出调用之前产生的日志并等待完成，返回期限到达时仍未写出的日志数量
+func (logger *Logger) Flush(ctx context.Context) (int, error) {
+	if logger.deduper != nil {
+		logger.deduper.flush()
+	}
+	if logger.limiter != nil {
+		logger.limiter.flush()
+	}
+	if logger.queue == nil {
+		return 0, nil
+	}
+	return logger.queue.flushWithContext(ctx, false)
+}
+
+// Close 写出剩余的日志并关闭文件或 Writer，返回期限到达时仍未写出而丢失的日志数量，共用同一文件的 Logger 会同时关闭
+func (logger *Logger) Close(ctx context.Context) (int, error) {
+	if logger.deduper != nil {
+		logger.deduper.flush()
+	}
+	if logger.limiter != nil {
+		logger.limiter.flush()
+	}
+	if logger.queue == nil {
+		return 0, nil
+	}
+	return logger.queue.flushWithContext(ctx, true)
+}
+
+// GetDropped 返回因写入队列已满而被丢弃的日志数量
+func (logger *Logger) GetDropped() uint64 {
+	if logger.queue == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&logger.queue.dropped)
+}
+
 func (logger *Logger) CheckLevel(logLevel LevelType) bool {
 	settedLevel := logger.level
 	if settedLevel == 0 {
@@ -395,7 +695,18 @@ func flat(v reflect.Value, out reflect.Value) {
 //var changeDayLock sync.Mutex = sync.Mutex{}
 
 func (logger *Logger) Log(data interface{}) {
+	if logger.deduper != nil && !logger.deduper.check(logger, data) {
+		return
+	}
+	if logger.limiter != nil && !logger.limiter.allow(getLogKey(data)) {
+		// 在序列化之前丢弃被采样或限流的日志
+		return
+	}
+	logger.log(data, "")
+}
 
+// log 序列化并写出日志，inject 为附加到日志开头的 JSON 字段
+func (logger *Logger) log(data interface{}, inject string) {
 	var buf []byte
 	var err error
 	if !logger.config.Fast {
@@ -438,6 +749,13 @@ func (logger *Logger) Log(data interface{}) {
 	}
 
 	if err == nil {
+		if logger.spanId != "" && len(buf) > 2 && buf[0] == '{' && !bytes.Contains(buf, []byte("\"SpanId\":")) && !bytes.Contains(buf, []byte("\"spanId\":")) {
+			// 附加 spanId 用于与链路追踪关联
+			buf = append([]byte("{\"SpanId\":\""+logger.spanId+"\","), buf[1:]...)
+		}
+		if inject != "" && len(buf) > 2 && buf[0] == '{' {
+			buf = append([]byte("{"+inject+","), buf[1:]...)
+		}
 		if !logger.config.KeepKeyCase {
 			if bytes.Index(buf, []byte("Header")) != -1 {
 				u.FixUpperCase(buf, []string{"Header"})
@@ -446,15 +764,15 @@ func (logger *Logger) Log(data interface{}) {
 			}
 		}
 
-		if logger.writer != nil {
+		if logger.queue != nil && logger.writer != nil {
 			if writerRunning {
-				logger.writer.Log(buf)
+				logger.queue.put(Log{time: time.Now(), level: getLogLevel(data), data: buf})
 			} else {
 				log.Print("writer not running")
 				log.Print(string(buf))
 			}
-		} else if logger.file != nil {
-			logger.file.Write(time.Now(), string(buf))
+		} else if logger.queue != nil {
+			logger.queue.put(Log{time: time.Now(), level: getLogLevel(data), data: buf})
 		} else if logger.goLogger == nil {
 			fmt.Println(Viewable(string(buf)))
 		} else {
@@ -496,6 +814,32 @@ func (logger *Logger) Log(data interface{}) {
 	}
 }
 
+// getLogLevel 根据日志类型判断日志级别，用于队列满时按级别丢弃
+func getLogLevel(data interface{}) LevelType {
+	logType := ""
+	switch v := data.(type) {
+	case standard.ErrorLog, *standard.ErrorLog, standard.DBErrorLog, *standard.DBErrorLog, standard.ServerErrorLog, *standard.ServerErrorLog:
+		return ERROR
+	case standard.WarningLog, *standard.WarningLog:
+		return WARNING
+	case standard.DebugLog, *standard.DebugLog:
+		return DEBUG
+	case map[string]interface{}:
+		logType = u.String(v["logType"])
+	case *standard.BaseLog:
+		logType = v.LogType
+	}
+	switch logType {
+	case standard.LogTypeError, standard.LogTypeDbError, standard.LogTypeServerError:
+		return ERROR
+	case standard.LogTypeWarning:
+		return WARNING
+	case standard.LogTypeDebug:
+		return DEBUG
+	}
+	return INFO
+}
+
 func (logger *Logger) getCallStacks() []string {
 	callStacks := make([]string, 0)
 	for i := 0; i < 50; i++ {
@@ -2,10 +2,13 @@ package log_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	log2 "log"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -198,6 +201,326 @@ func TestLogMap(t *testing.T) {
 	_ = os.Remove(logFile)
 }
 
+func TestLogMaxSize(t *testing.T) {
+	logFile := "tmp_test_max_size.Log"
+	logFile1 := logFile + "." + time.Now().Format("20060102")
+	removeLogFiles := func() {
+		files, _ := filepath.Glob(logFile + ".*")
+		for _, f := range files {
+			_ = os.Remove(f)
+		}
+	}
+	removeLogFiles()
+	// 无关文件和使用其他切割周期的写入器的文件不能被清理
+	otherFiles := []string{logFile + ".keep", logFile + "." + time.Now().Format("2006010215"), logFile + "." + time.Now().Format("2006010215") + ".1.gz"}
+	for _, f := range otherFiles {
+		_ = u.WriteFile(f, "other")
+	}
+	logger := log.NewLogger(log.Config{
+		File:     logFile,
+		SplitTag: "20060102",
+		MaxSize:  "1K",
+		MaxFiles: 2,
+	})
+	for i := 0; i < 20; i++ {
+		logger.Info("Test max size", "index", i)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if !u.FileExists(logFile1 + ".4") {
+		t.Error("max size roll test failed")
+	}
+	if info := u.GetFileInfo(logFile1 + ".4"); info == nil || info.Size > 1024 {
+		t.Error("max size limit test failed", info)
+	}
+	files, _ := filepath.Glob(logFile + ".*")
+	if len(files) != 3+len(otherFiles) {
+		t.Error("max files test failed", files)
+	}
+	for _, f := range otherFiles {
+		if !u.FileExists(f) {
+			t.Error("max files prune other file test failed", f)
+		}
+	}
+	removeLogFiles()
+}
+
+func TestLogCompress(t *testing.T) {
+	logFile := "tmp_test_compress.Log"
+	logFile1 := logFile + "." + time.Now().Format("20060102")
+	removeLogFiles := func() {
+		files, _ := filepath.Glob(logFile + ".*")
+		for _, f := range files {
+			_ = os.Remove(f)
+		}
+	}
+	removeLogFiles()
+	for _, compress := range []string{"gzip", "zstd"} {
+		logger := log.NewLogger(log.Config{
+			File:     logFile,
+			SplitTag: "20060102-" + compress,
+			MaxSize:  "1K",
+			Compress: compress,
+		})
+		for i := 0; i < 10; i++ {
+			logger.Info("Test compress", "index", i)
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		compressedFile := logFile1 + "-" + compress + ".gz"
+		if compress == "zstd" {
+			compressedFile = logFile1 + "-" + compress + ".zst"
+		}
+		if u.FileExists(logFile1+"-"+compress) || !u.FileExists(compressedFile) {
+			t.Error("compress test failed", compress)
+		}
+		n := 0
+		err := log.ParseLogFile(compressedFile, func(baseLog *standard.BaseLog) {
+			if baseLog.Extra["info"] == "Test compress" {
+				n++
+			}
+		})
+		if err != nil || n == 0 {
+			t.Error("read compressed file test failed", compress, n, err)
+		}
+	}
+	removeLogFiles()
+}
+
+type slowWriter struct {
+	release chan bool
+}
+
+func (w *slowWriter) Log([]byte) {
+	<-w.release
+}
+
+func (w *slowWriter) Run() {
+}
+
+func TestLogQueuePolicy(t *testing.T) {
+	for _, policy := range []string{"", log.QueueDropNewest, log.QueueDropOldest, log.QueueDropLevel} {
+		release := make(chan bool)
+		log.RegisterWriterMaker("slow", func(conf *log.Config) log.Writer {
+			return &slowWriter{release: release}
+		})
+		logger := log.NewLogger(log.Config{File: "slow://", QueueSize: 2, QueuePolicy: policy})
+		for i := 0; i < 10; i++ {
+			logger.Info("Test queue policy", "index", i)
+		}
+		if logger.GetDropped() < 7 {
+			t.Error("queue policy test failed", policy, logger.GetDropped())
+		}
+		close(release)
+	}
+}
+
+func TestLogFlushAndClose(t *testing.T) {
+	logFile := "tmp_test_flush.Log"
+	logFile1 := logFile + "." + time.Now().Format("20060102")
+	_ = os.Remove(logFile1)
+	logger := log.NewLogger(log.Config{
+		File:          logFile,
+		SplitTag:      "20060102",
+		FlushInterval: "10s",
+		FlushSize:     1000,
+	})
+	for i := 0; i < 10; i++ {
+		logger.Info("Test flush", "index", i)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	lost, err := logger.Flush(ctx)
+	cancel()
+	lines, _ := u.ReadFileLines(logFile1)
+	if lost != 0 || err != nil || len(lines) != 11 {
+		t.Error("flush test failed", lost, err, len(lines))
+	}
+	_ = os.Remove(logFile1)
+
+	release := make(chan bool)
+	log.RegisterWriterMaker("slow", func(conf *log.Config) log.Writer {
+		return &slowWriter{release: release}
+	})
+	slowLogger := log.NewLogger(log.Config{File: "slow://"})
+	for i := 0; i < 10; i++ {
+		slowLogger.Info("Test close", "index", i)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	lost, err = slowLogger.Close(ctx)
+	cancel()
+	if lost < 9 || err == nil {
+		t.Error("close test failed", lost, err)
+	}
+	close(release)
+}
+
+func TestLogWith(t *testing.T) {
+	logger := log.NewLogger(log.Config{}).With("userId", 101, "tenant", "t1").With("tenant", "t2")
+	baseLog := logger.MakeBaseLog("info", "jobId", "j1", "userId", 102)
+	if baseLog.Extra["tenant"] != "t2" || baseLog.Extra["jobId"] != "j1" || baseLog.Extra["userId"] != 102 {
+		t.Error("with test failed", baseLog.Extra)
+	}
+	extra := map[string]interface{}{"jobId": "j2"}
+	baseLog = logger.MakeBaseLog("info", extra)
+	if baseLog.Extra["tenant"] != "t2" || baseLog.Extra["jobId"] != "j2" || len(extra) != 1 {
+		t.Error("with map test failed", baseLog.Extra, extra)
+	}
+}
+
+func TestLogContext(t *testing.T) {
+	if log.FromContext(context.Background()) != log.DefaultLogger {
+		t.Error("context default logger test failed")
+	}
+	ctx := log.NewContext(context.Background(), log.New("trace123").With("tenant", "t1"))
+	ctx = log.ContextWith(ctx, "jobId", "j1")
+	logger := log.FromContext(ctx)
+	if logger.GetTraceId() != "trace123" || logger.GetFields()["tenant"] != "t1" || logger.GetFields()["jobId"] != "j1" {
+		t.Error("context logger test failed", logger.GetTraceId(), logger.GetFields())
+	}
+}
+
 // func TestStop(m *testing.T) {
 // 	log.Start()
 // }
+
+func TestLogRunTask(t *testing.T) {
+	logFile := "tmp_test_task.Log"
+	_ = os.Remove(logFile)
+	logger := log.NewLogger(log.Config{File: logFile})
+
+	if err := logger.RunTask("task1", map[string]interface{}{"id": 1}, func() error { return nil }); err != nil {
+		t.Error("task succeed test failed", err)
+	}
+	if err := logger.RunTask("task2", nil, func() error { return errors.New("not found") }); err == nil || err.Error() != "not found" {
+		t.Error("task error test failed", err)
+	}
+	if err := logger.RunTask("task3", nil, func() error { panic("oops") }); err == nil || err.Error() != "panic: oops" {
+		t.Error("task panic test failed", err)
+	}
+	_, _ = logger.Flush(context.Background())
+
+	lines, _ := u.ReadFileLines(logFile)
+	if len(lines) != 4 {
+		t.Fatal("task log test failed", len(lines))
+	}
+	if !strings.Contains(lines[0], `"name":"task1"`) || !strings.Contains(lines[0], `"succeed":true`) || !strings.Contains(lines[0], `"args":{"id":1}`) {
+		t.Error("task succeed log test failed", lines[0])
+	}
+	if !strings.Contains(lines[1], `"succeed":false`) || !strings.Contains(lines[1], `"memo":"not found"`) {
+		t.Error("task error log test failed", lines[1])
+	}
+	if !strings.Contains(lines[2], `"succeed":false`) || !strings.Contains(lines[2], `"memo":"panic: oops\n`) || !strings.Contains(lines[2], "Logger_test.go") {
+		t.Error("task panic log test failed", lines[2])
+	}
+	_ = os.Remove(logFile)
+}
+
+func TestLogStatCollector(t *testing.T) {
+	logFile := "tmp_test_stat.Log"
+	_ = os.Remove(logFile)
+	logger := log.NewLogger(log.Config{Name: "appA", File: logFile})
+
+	stat := logger.NewStatCollector(log.StatOptions{Interval: "1h"})
+	for i := 1; i <= 100; i++ {
+		stat.Observe("api1", time.Duration(i)*time.Millisecond, i%10 != 0)
+	}
+	stat.Observe("api2", 5*time.Millisecond, true)
+	stat.Stop()
+	_, _ = logger.Flush(context.Background())
+
+	lines, _ := u.ReadFileLines(logFile)
+	if len(lines) != 3 {
+		t.Fatal("stat log test failed", len(lines))
+	}
+	for _, s := range []string{`"name":"api1"`, `"app":"appA"`, `"times":100`, `"failed":10`, `"avg":50.5`, `"min":1`, `"max":100`, `\"p50\":50`, `\"p90\":90`, `\"p99\":99`} {
+		if !strings.Contains(lines[0], s) {
+			t.Error("stat log test failed", s, lines[0])
+		}
+	}
+	if !strings.Contains(lines[1], `"name":"api2"`) || !strings.Contains(lines[1], `\"p99\":5`) {
+		t.Error("stat log test failed", lines[1])
+	}
+
+	// 无效的间隔使用默认值，不能在后台 panic
+	for _, interval := range []string{"0s", "-1s", "abc"} {
+		logger.NewStatCollector(log.StatOptions{Interval: interval}).Stop()
+	}
+	_ = os.Remove(logFile)
+}
+
+func TestLogSampling(t *testing.T) {
+	logFile := "tmp_test_sampling.Log"
+	_ = os.Remove(logFile)
+	logger := log.NewLogger(log.Config{File: logFile, SampleFirst: 3, SampleThereafter: 10, SampleInterval: "1h"})
+	for i := 0; i < 100; i++ {
+		logger.Error("crash")
+	}
+	logger.Error("another")
+	_, _ = logger.Flush(context.Background())
+
+	lines, _ := u.ReadFileLines(logFile)
+	// 前 3 条，之后每 10 条 1 条，加上 another 和汇总日志
+	if len(lines) != 3+9+1+1+1 {
+		t.Fatal("sampling test failed", len(lines))
+	}
+	if !strings.Contains(lines[len(lines)-2], `"warning":"suppressed 88 logs"`) || !strings.Contains(lines[len(lines)-2], `\"sampled\":88`) {
+		t.Error("sampling summary test failed", lines[len(lines)-2])
+	}
+
+	// 被采样丢弃的日志不获取调用栈、不生成日志对象
+	logger = log.NewLogger(log.Config{File: logFile, SampleFirst: 1, SampleInterval: "1h"})
+	logger.Error("crash")
+	if allocs := testing.AllocsPerRun(100, func() { logger.Error("crash", "i", 1) }); allocs > 2 {
+		t.Error("sampling allocs test failed", allocs)
+	}
+	_, _ = logger.Flush(context.Background())
+	_ = os.Remove(logFile)
+
+	logFile = "tmp_test_rate_limit.Log"
+	_ = os.Remove(logFile)
+	logger = log.NewLogger(log.Config{File: logFile, RateLimit: 1, RateBurst: 5, SampleInterval: "20ms"})
+	for i := 0; i < 20; i++ {
+		logger.Info("info", "i", i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	_, _ = logger.Flush(context.Background())
+	lines, _ = u.ReadFileLines(logFile)
+	if len(lines) != 5+1+1 || !strings.Contains(lines[5], `\"rateLimited\":15`) {
+		t.Error("rate limit test failed", len(lines), lines)
+	}
+	_ = os.Remove(logFile)
+}
+
+func TestLogDedup(t *testing.T) {
+	logFile := "tmp_test_dedup.Log"
+	_ = os.Remove(logFile)
+	logger := log.NewLogger(log.Config{File: logFile, Dedup: "50ms"})
+	for i := 0; i < 10; i++ {
+		logger.Warning("retry failed")
+	}
+	logger.Warning("retry failed")
+	logger.Warning("other")
+	for i := 0; i < 3; i++ {
+		logger.Error("timeout")
+	}
+	time.Sleep(100 * time.Millisecond)
+	logger.Error("timeout")
+	_, _ = logger.Flush(context.Background())
+
+	lines, _ := u.ReadFileLines(logFile)
+	if len(lines) != 8 {
+		t.Fatal("dedup test failed", len(lines), lines)
+	}
+	if strings.Contains(lines[0], "repeated") || !strings.Contains(lines[1], `"repeated":9`) || !strings.Contains(lines[1], `"firstTime":"`) || !strings.Contains(lines[1], `"lastTime":"`) {
+		t.Error("dedup repeated test failed", lines[0], lines[1])
+	}
+	// 调用栈不同时不合并
+	if strings.Contains(lines[2], "repeated") || !strings.Contains(lines[2], "retry failed") || !strings.Contains(lines[3], `"warning":"other"`) {
+		t.Error("dedup call stack test failed", lines[2], lines[3])
+	}
+	// 窗口结束时输出合并的日志，之后相同的日志重新记录
+	if !strings.Contains(lines[5], `"repeated":2`) || strings.Contains(lines[6], "repeated") || !strings.Contains(lines[6], "timeout") {
+		t.Error("dedup window test failed", lines[5], lines[6])
+	}
+	_ = os.Remove(logFile)
+}
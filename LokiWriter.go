@@ -0,0 +1,249 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/ssgo/u"
+)
+
+type lokiWriter struct {
+	config   *Config
+	url      string
+	user     string
+	password string
+	tenant   string
+	labels   []string // 作为 stream 标签的日志字段
+	compress string   // 请求内容的压缩方式，gzip 或 snappy（snappy 使用 protobuf 格式）
+	retry    int      // 发送失败时的重试次数
+	client   *http.Client
+	lock     sync.Mutex
+	streams  map[string]*lokiStream
+	count    int
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	Values [][2]string       `json:"values"`
+}
+
+// lokiWriterMaker 支持 loki://host:port 和 lokis://host:port（https），
+// 参数：labels=logName,logType（作为标签的日志字段）、compress=gzip|snappy（loki 只支持 snappy 压缩的 protobuf 请求）、retry=3、timeout=10s、tenant=xxx（X-Scope-OrgID）
+func lokiWriterMaker(conf *Config) Writer {
+	w := new(lokiWriter)
+	w.config = conf
+	w.client = new(http.Client)
+	w.streams = map[string]*lokiStream{}
+	lokiUrl, err := url.Parse(conf.File)
+	if err != nil {
+		DefaultLogger.Error(err.Error(), "conf", conf)
+		return nil
+	}
+
+	if lokiUrl.User != nil {
+		w.user = lokiUrl.User.Username()
+		w.password, _ = lokiUrl.User.Password()
+		lokiUrl.User = nil
+	}
+	if lokiUrl.Scheme == "lokis" {
+		lokiUrl.Scheme = "https"
+	} else {
+		lokiUrl.Scheme = "http"
+	}
+
+	q := lokiUrl.Query()
+	w.client.Timeout = 10 * time.Second
+	if timeout := q.Get("timeout"); timeout != "" {
+		w.client.Timeout = u.Duration(timeout)
+	}
+	w.labels = u.SplitTrim(q.Get("labels"), ",")
+	if len(w.labels) == 0 {
+		w.labels = []string{"logName", "logType"}
+	}
+	w.compress = strings.ToLower(q.Get("compress"))
+	if w.compress != "" && w.compress != "gzip" && w.compress != "snappy" {
+		DefaultLogger.Error("unsupported loki compress "+w.compress, "conf", conf)
+		w.compress = ""
+	}
+	w.retry = 3
+	if retry := q.Get("retry"); retry != "" {
+		w.retry = u.Int(retry)
+	}
+	w.tenant = q.Get("tenant")
+
+	lokiUrl.Path = "/loki/api/v1/push"
+	lokiUrl.RawQuery = ""
+	w.url = lokiUrl.String()
+	return w
+}
+
+// Log 将标签字段从日志中取出作为 stream 的标签，其余的内容作为日志行
+func (w *lokiWriter) Log(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	tm := getLogTime(data)
+	labels := map[string]string{}
+	line := string(data)
+
+	fields := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if decoder.Decode(&fields) == nil {
+		for _, label := range w.labels {
+			for _, k := range []string{label, strings.ToUpper(label[0:1]) + label[1:]} {
+				if v, ok := fields[k]; ok {
+					if s := u.String(v); s != "" {
+						labels[label] = s
+					}
+					delete(fields, k)
+				}
+			}
+		}
+		if buf, err := json.Marshal(fields); err == nil {
+			line = string(buf)
+		}
+	}
+	if len(labels) == 0 {
+		// loki 要求每个 stream 至少有一个标签
+		labels["logName"] = w.config.Name
+	}
+
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	streamKey := ""
+	for _, k := range keys {
+		streamKey += k + "=" + labels[k] + "\n"
+	}
+
+	w.lock.Lock()
+	stream := w.streams[streamKey]
+	if stream == nil {
+		stream = &lokiStream{Stream: labels}
+		w.streams[streamKey] = stream
+	}
+	stream.Values = append(stream.Values, [2]string{strconv.FormatInt(tm.UnixNano(), 10), line})
+	w.count++
+	w.lock.Unlock()
+}
+
+// Run 由写入队列调用，发送缓存的日志
+func (w *lokiWriter) Run() {
+	_, _ = w.flush(context.Background())
+}
+
+// Flush 按期限发送缓存的日志，返回发送失败的日志数量
+func (w *lokiWriter) Flush(ctx context.Context) (int, error) {
+	return w.flush(ctx)
+}
+
+func (w *lokiWriter) Close(ctx context.Context) (int, error) {
+	return w.flush(ctx)
+}
+
+func (w *lokiWriter) flush(ctx context.Context) (int, error) {
+	w.lock.Lock()
+	streams := w.streams
+	count := w.count
+	w.streams = map[string]*lokiStream{}
+	w.count = 0
+	w.lock.Unlock()
+	if count == 0 {
+		return 0, nil
+	}
+
+	header := http.Header{}
+	var data []byte
+	if w.compress == "snappy" {
+		data = snappy.Encode(nil, makeLokiPushRequest(streams))
+		header.Set("Content-Type", "application/x-protobuf")
+	} else {
+		body := struct {
+			Streams []*lokiStream `json:"streams"`
+		}{Streams: make([]*lokiStream, 0, len(streams))}
+		for _, stream := range streams {
+			body.Streams = append(body.Streams, stream)
+		}
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return count, err
+		}
+		header.Set("Content-Type", "application/json")
+		if w.compress == "gzip" {
+			buf := new(bytes.Buffer)
+			gz := gzip.NewWriter(buf)
+			_, _ = gz.Write(data)
+			_ = gz.Close()
+			data = buf.Bytes()
+			header.Set("Content-Encoding", "gzip")
+		}
+	}
+	if w.tenant != "" {
+		header.Set("X-Scope-OrgID", w.tenant)
+	}
+	if w.user != "" {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(w.user+":"+w.password)))
+	}
+	err := postWithRetry(ctx, w.client, w.url, data, header, w.retry)
+	if err == nil {
+		return 0, nil
+	}
+	log.Println("loki sent failed", err.Error(), count)
+	return count, err
+}
+
+// makeLokiPushRequest 生成 loki 的 protobuf 格式 PushRequest（logproto.PushRequest），
+// 结构为 streams(1){labels(1) entries(2){timestamp(1){seconds(1) nanos(2)} line(2)}}
+func makeLokiPushRequest(streams map[string]*lokiStream) []byte {
+	out := make([]byte, 0, 4096)
+	for _, stream := range streams {
+		keys := make([]string, 0, len(stream.Stream))
+		for k := range stream.Stream {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		labels := make([]string, 0, len(keys))
+		for _, k := range keys {
+			labels = append(labels, k+"="+strconv.Quote(stream.Stream[k]))
+		}
+
+		streamBuf := appendProtoBytes(nil, 1, []byte("{"+strings.Join(labels, ", ")+"}"))
+		for _, value := range stream.Values {
+			tm, _ := strconv.ParseInt(value[0], 10, 64)
+			timestamp := appendProtoVarint(nil, 1, uint64(tm/1e9))
+			timestamp = appendProtoVarint(timestamp, 2, uint64(tm%1e9))
+			entry := appendProtoBytes(nil, 1, timestamp)
+			entry = appendProtoBytes(entry, 2, []byte(value[1]))
+			streamBuf = appendProtoBytes(streamBuf, 2, entry)
+		}
+		out = appendProtoBytes(out, 1, streamBuf)
+	}
+	return out
+}
+
+func appendProtoVarint(buf []byte, field int, v uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field<<3))
+	return binary.AppendUvarint(buf, v)
+}
+
+func appendProtoBytes(buf []byte, field int, v []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(field<<3|2))
+	buf = binary.AppendUvarint(buf, uint64(len(v)))
+	return append(buf, v...)
+}
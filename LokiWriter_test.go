@@ -0,0 +1,188 @@
+package log_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/ssgo/log"
+)
+
+type lokiPush struct {
+	Streams []struct {
+		Stream map[string]string
+		Values [][2]string
+	}
+}
+
+var lokiLabelMatcher = regexp.MustCompile(`(\w+)=("(?:[^"\\]|\\.)*")`)
+
+// readProtoFields 读取一层 protobuf 字段，只支持 varint 和 length-delimited 类型
+func readProtoFields(buf []byte) (map[int][][]byte, map[int][]uint64, error) {
+	bytesFields := map[int][][]byte{}
+	varintFields := map[int][]uint64{}
+	for len(buf) > 0 {
+		tag, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, nil, errors.New("bad tag")
+		}
+		buf = buf[n:]
+		v, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, nil, errors.New("bad value")
+		}
+		buf = buf[n:]
+		switch tag & 7 {
+		case 0:
+			varintFields[int(tag>>3)] = append(varintFields[int(tag>>3)], v)
+		case 2:
+			if uint64(len(buf)) < v {
+				return nil, nil, errors.New("bad length")
+			}
+			bytesFields[int(tag>>3)] = append(bytesFields[int(tag>>3)], buf[0:v])
+			buf = buf[v:]
+		default:
+			return nil, nil, errors.New("unsupported wire type")
+		}
+	}
+	return bytesFields, varintFields, nil
+}
+
+// decodeLokiProtobuf 按 loki 的 logproto.PushRequest 解析请求
+func decodeLokiProtobuf(buf []byte) (push lokiPush, err error) {
+	request, _, err := readProtoFields(buf)
+	if err != nil {
+		return push, err
+	}
+	for _, streamBuf := range request[1] {
+		stream, _, err := readProtoFields(streamBuf)
+		if err != nil || len(stream[1]) != 1 {
+			return push, errors.New("bad stream")
+		}
+		s := struct {
+			Stream map[string]string
+			Values [][2]string
+		}{Stream: map[string]string{}}
+		for _, m := range lokiLabelMatcher.FindAllStringSubmatch(string(stream[1][0]), -1) {
+			s.Stream[m[1]], _ = strconv.Unquote(m[2])
+		}
+		for _, entryBuf := range stream[2] {
+			entry, _, err := readProtoFields(entryBuf)
+			if err != nil || len(entry[1]) != 1 || len(entry[2]) != 1 {
+				return push, errors.New("bad entry")
+			}
+			_, timestamp, err := readProtoFields(entry[1][0])
+			if err != nil || len(timestamp[1]) != 1 {
+				return push, errors.New("bad timestamp")
+			}
+			tm := int64(timestamp[1][0]) * 1e9
+			if len(timestamp[2]) == 1 {
+				tm += int64(timestamp[2][0])
+			}
+			s.Values = append(s.Values, [2]string{strconv.FormatInt(tm, 10), string(entry[2][0])})
+		}
+		push.Streams = append(push.Streams, s)
+	}
+	return push, nil
+}
+
+func TestLokiWriter(t *testing.T) {
+	lock := sync.Mutex{}
+	requests := 0
+	pushes := make([]lokiPush, 0)
+	encodings := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		requests++
+		if r.URL.Path != "/loki/api/v1/push" || r.Header.Get("X-Scope-OrgID") != "team1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if requests == 1 {
+			// 第一次请求失败，测试重试
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		// 与 loki 一致：protobuf 请求使用 snappy 解压，JSON 请求只支持 gzip 的 Content-Encoding
+		push := lokiPush{}
+		var err error
+		switch r.Header.Get("Content-Type") {
+		case "application/x-protobuf":
+			buf, _ := io.ReadAll(r.Body)
+			if buf, err = snappy.Decode(nil, buf); err == nil {
+				push, err = decodeLokiProtobuf(buf)
+			}
+		case "application/json":
+			var reader io.Reader = r.Body
+			switch r.Header.Get("Content-Encoding") {
+			case "":
+			case "gzip":
+				reader, err = gzip.NewReader(r.Body)
+			default:
+				err = errors.New("unsupported Content-Encoding")
+			}
+			if err == nil {
+				err = json.NewDecoder(reader).Decode(&push)
+			}
+		default:
+			err = errors.New("unsupported Content-Type")
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		pushes = append(pushes, push)
+		encodings = append(encodings, r.Header.Get("Content-Type")+" "+r.Header.Get("Content-Encoding"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	lokiUrl := strings.Replace(server.URL, "http://", "loki://", 1) + "?tenant=team1&labels=logName,logType&compress=gzip"
+	logger := log.NewLogger(log.Config{Name: "appLoki", File: lokiUrl, FlushInterval: "10ms"})
+	logger.Info("hello", "userId", 1)
+	logger.Error("failed")
+	logger.Info("world")
+	if lost, err := logger.Flush(context.Background()); lost != 0 || err != nil {
+		t.Fatal("loki flush failed", lost, err)
+	}
+
+	lokiUrl = strings.Replace(server.URL, "http://", "loki://", 1) + "?tenant=team1&labels=serverName&compress=snappy"
+	logger2 := log.NewLogger(log.Config{Name: "appLoki", File: lokiUrl, FlushInterval: "10ms"})
+	logger2.Warning("snappy")
+	_, _ = logger2.Flush(context.Background())
+
+	lock.Lock()
+	defer lock.Unlock()
+	if requests != 3 || len(pushes) != 2 || encodings[0] != "application/json gzip" || encodings[1] != "application/x-protobuf " {
+		t.Fatal("loki request test failed", requests, len(pushes), encodings)
+	}
+	streams := map[string][][2]string{}
+	for _, s := range pushes[0].Streams {
+		if s.Stream["logName"] != "appLoki" {
+			t.Error("loki label test failed", s.Stream)
+		}
+		streams[s.Stream["logType"]] = s.Values
+	}
+	if len(streams["info"]) != 2 || len(streams["error"]) != 1 {
+		t.Fatal("loki stream test failed", streams)
+	}
+	line := streams["info"][0][1]
+	if !strings.Contains(line, `"info":"hello"`) || !strings.Contains(line, `\"userId\":1`) || strings.Contains(line, "logName") || strings.Contains(line, "logType") || len(streams["info"][0][0]) < 19 {
+		t.Error("loki line test failed", streams["info"][0])
+	}
+	if len(pushes[1].Streams) != 1 || pushes[1].Streams[0].Stream["serverName"] == "" || !strings.Contains(pushes[1].Streams[0].Values[0][1], `"logType":"warning"`) || len(pushes[1].Streams[0].Values[0][0]) < 19 {
+		t.Error("loki snappy test failed", pushes[1])
+	}
+}
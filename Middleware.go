@@ -0,0 +1,235 @@
+package log
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ssgo/standard"
+)
+
+type MiddlewareOptions struct {
+	App             string   // 当前应用名称，默认使用 Config.Name
+	SkipPaths       []string // 不记录日志的路径，以 * 结尾时按前缀匹配
+	MaxBodySize     int      // 记录请求内容的最大长度，默认 4096，小于0时不记录
+	MaxResponseSize int      // 记录响应内容的最大长度，默认 0 不记录
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status  int
+	size    uint
+	body    bytes.Buffer
+	maxBody int
+}
+
+func (w *responseRecorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if left := w.maxBody - w.body.Len(); left > 0 {
+		if left > len(b) {
+			left = len(b)
+		}
+		w.body.Write(b[0:left])
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += uint(n)
+	return n, err
+}
+
+func (w *responseRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack 支持 websocket 等需要接管连接的处理，未设置状态时记录为 101
+func (w *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (w *responseRecorder) Push(target string, opts *http.PushOptions) error {
+	if p, ok := w.ResponseWriter.(http.Pusher); ok {
+		return p.Push(target, opts)
+	}
+	return http.ErrNotSupported
+}
+
+// ReadFrom 在不需要记录响应内容时使用底层的 io.ReaderFrom（如 sendfile）
+func (w *responseRecorder) ReadFrom(r io.Reader) (int64, error) {
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok && w.body.Len() >= w.maxBody {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		n, err := rf.ReadFrom(r)
+		w.size += uint(n)
+		return n, err
+	}
+	return io.Copy(struct{ io.Writer }{w}, r)
+}
+
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// GetClientIp 获取客户端的真实IP，优先使用 X-Real-Ip，其次是 X-Forwarded-For 中的第一个地址
+func GetClientIp(r *http.Request) string {
+	if ip := strings.TrimSpace(r.Header.Get(standard.DiscoverHeaderClientIp)); ip != "" {
+		return ip
+	}
+	if forwardedFor := r.Header.Get(standard.DiscoverHeaderForwardedFor); forwardedFor != "" {
+		if ip := strings.TrimSpace(strings.SplitN(forwardedFor, ",", 2)[0]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (options *MiddlewareOptions) skip(path string) bool {
+	for _, p := range options.SkipPaths {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, p[0:len(p)-1]) {
+				return true
+			}
+		} else if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// readRequestData 读取不超过 maxSize 的请求内容，并将读取的内容放回 Body 供后续处理使用
+func readRequestData(r *http.Request, maxSize int) map[string]interface{} {
+	requestData := map[string]interface{}{}
+	for k, v := range r.URL.Query() {
+		requestData[k] = strings.Join(v, ",")
+	}
+	if r.Body == nil || r.Body == http.NoBody || maxSize <= 0 {
+		return requestData
+	}
+
+	buf := make([]byte, maxSize+1)
+	n, _ := io.ReadFull(r.Body, buf)
+	buf = buf[0:n]
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+	if n == 0 {
+		return requestData
+	}
+	if n > maxSize {
+		requestData["body"] = string(buf[0:maxSize]) + "..."
+		return requestData
+	}
+
+	contentType := r.Header.Get("Content-Type")
+	if strings.Contains(contentType, "json") {
+		data := map[string]interface{}{}
+		if json.Unmarshal(buf, &data) == nil {
+			for k, v := range data {
+				requestData[k] = v
+			}
+			return requestData
+		}
+	} else if strings.Contains(contentType, "x-www-form-urlencoded") {
+		if values, err := url.ParseQuery(string(buf)); err == nil {
+			for k, v := range values {
+				requestData[k] = strings.Join(v, ",")
+			}
+			return requestData
+		}
+	}
+	requestData["body"] = string(buf)
+	return requestData
+}
+
+func flatHeader(header http.Header) map[string]string {
+	out := make(map[string]string, len(header))
+	for k, v := range header {
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+// Middleware 返回记录请求日志的 http.Handler，请求的 Logger 会放入 Context 中，可以通过 FromContext 获取
+func (logger *Logger) Middleware(next http.Handler, options MiddlewareOptions) http.Handler {
+	if options.App == "" {
+		options.App = logger.config.Name
+	}
+	if options.MaxBodySize == 0 {
+		options.MaxBodySize = 4096
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if options.skip(r.URL.Path) || !logger.CheckLevel(INFO) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		startTime := time.Now()
+		requestId := r.Header.Get(standard.DiscoverHeaderRequestId)
+		reqLogger := logger.FromHeader(r.Header)
+		if reqLogger == logger && requestId != "" {
+			reqLogger = logger.New(requestId)
+		}
+		requestData := readRequestData(r, options.MaxBodySize)
+		requestHeaders := flatHeader(r.Header)
+
+		recorder := &responseRecorder{ResponseWriter: w, maxBody: options.MaxResponseSize}
+		next.ServeHTTP(recorder, r.WithContext(NewContext(r.Context(), reqLogger)))
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+
+		node := ""
+		if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+			node = addr.String()
+		}
+		scheme := r.Header.Get(standard.DiscoverHeaderScheme)
+		if scheme == "" {
+			scheme = "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+		}
+		host := r.Header.Get(standard.DiscoverHeaderHost)
+		if host == "" {
+			host = r.Host
+		}
+
+		reqLogger.Log(reqLogger.MakeRequestLog(standard.LogTypeRequest, "", options.App, node, GetClientIp(r),
+			r.Header.Get(standard.DiscoverHeaderFromApp), r.Header.Get(standard.DiscoverHeaderFromNode),
+			r.Header.Get(standard.DiscoverHeaderUserId), r.Header.Get(standard.DiscoverHeaderDeviceId),
+			r.Header.Get(standard.DiscoverHeaderClientAppName), r.Header.Get(standard.DiscoverHeaderClientAppVersion),
+			r.Header.Get(standard.DiscoverHeaderSessionId), requestId, host, scheme, strings.TrimPrefix(r.Proto, "HTTP/"),
+			0, 0, r.Method, r.URL.Path, requestHeaders, requestData, MakeUesdTime(startTime, time.Now()),
+			recorder.status, flatHeader(recorder.Header()), recorder.size, recorder.body.String()))
+	})
+}
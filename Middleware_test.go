@@ -0,0 +1,135 @@
+package log_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssgo/log"
+	"github.com/ssgo/u"
+)
+
+func TestMiddleware(t *testing.T) {
+	logFile := "tmp_test_middleware.Log"
+	logFile1 := logFile + "." + time.Now().Format("20060102")
+	_ = os.Remove(logFile1)
+	logger := log.NewLogger(log.Config{Name: "appA", File: logFile, SplitTag: "20060102"})
+
+	handler := logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if log.FromContext(r.Context()).GetTraceId() != "req123" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(body)
+	}), log.MiddlewareOptions{SkipPaths: []string{"/health*"}, MaxResponseSize: 5})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL+"/users?page=2", strings.NewReader(`{"name":"Tom","token":"abcdefgh"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Access-Token", "abcdefg")
+	req.Header.Set("X-Forwarded-For", "59.32.113.241, 10.0.0.1")
+	req.Header.Set("X-Request-Id", "req123")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if res.StatusCode != http.StatusCreated || string(body) != `{"name":"Tom","token":"abcdefgh"}` {
+		t.Error("middleware response test failed", res.StatusCode, string(body))
+	}
+
+	res, _ = http.Get(server.URL + "/health/check")
+	_ = res.Body.Close()
+	_, _ = logger.Flush(context.Background())
+
+	lines, _ := u.ReadFileLines(logFile1)
+	if len(lines) != 2 {
+		t.Fatal("middleware skip test failed", len(lines))
+	}
+	for _, s := range []string{`"clientIp":"59.32.113.241"`, `"responseCode":201`, `"responseDataLength":33`, `"responseData":"{\"nam"`, `"access-Token":"ab***fg"`, `"token":"ab****gh"`, `"page":"2"`, `"requestId":"req123"`, `"traceId":"req123"`, `"path":"/users"`} {
+		if !strings.Contains(lines[0], s) {
+			t.Error("middleware log test failed", s, lines[0])
+		}
+	}
+	_ = os.Remove(logFile1)
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	logFile := "tmp_test_middleware_hijack.Log"
+	logFile1 := logFile + "." + time.Now().Format("20060102")
+	_ = os.Remove(logFile1)
+	logger := log.NewLogger(log.Config{Name: "appA", File: logFile, SplitTag: "20060102"})
+
+	handler := logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/file" {
+			_, _ = io.Copy(w, strings.NewReader("hello file"))
+			return
+		}
+		h, ok := w.(http.Hijacker)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		conn, rw, err := h.Hijack()
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		defer conn.Close()
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\nhi")
+		_ = rw.Flush()
+	}), log.MiddlewareOptions{})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = conn.Write([]byte("GET /ws HTTP/1.1\r\nHost: test\r\nUpgrade: test\r\nConnection: Upgrade\r\n\r\n"))
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	res, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	_ = conn.Close()
+	if err != nil || res.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatal("middleware hijack test failed", res, err)
+	}
+
+	res, err = http.Get(server.URL + "/file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if string(body) != "hello file" {
+		t.Error("middleware ReadFrom test failed", string(body))
+	}
+
+	// 底层不支持时返回 http.ErrNotSupported
+	logger.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, err := w.(http.Hijacker).Hijack(); err != http.ErrNotSupported {
+			t.Error("middleware hijack not supported test failed", err)
+		}
+		if err := w.(http.Pusher).Push("/a.js", nil); err != http.ErrNotSupported {
+			t.Error("middleware push not supported test failed", err)
+		}
+	}), log.MiddlewareOptions{}).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	_, _ = logger.Flush(context.Background())
+
+	lines, _ := u.ReadFileLines(logFile1)
+	if len(lines) != 4 || !strings.Contains(lines[0], `"responseCode":101`) || !strings.Contains(lines[1], `"responseDataLength":10`) {
+		t.Error("middleware hijack log test failed", lines)
+	}
+	_ = os.Remove(logFile1)
+}
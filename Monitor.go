@@ -1,6 +1,16 @@
 package log
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/ssgo/standard"
 )
 
@@ -25,3 +35,140 @@ func (logger *Logger) MakeMonitorLog(logType, name, target, targetInfo, expect,
 		Memo:       memo,
 	}
 }
+
+// Probe 定时执行的监控检查，Check 返回 error 时视为失败
+type Probe struct {
+	Name       string
+	Target     string
+	TargetInfo string
+	Expect     string
+	Interval   string                                               // 检查间隔，默认 1m
+	Timeout    string                                               // 单次检查的超时时间，默认 10s
+	Check      func(ctx context.Context) (result string, err error) // 为 nil 时视为检查失败
+}
+
+// HTTPProbe 使用 GET 请求检查 url，状态码等于 expectStatus（为 0 时为 200）且内容包含 expectBody 时成功
+func HTTPProbe(name, url string, expectStatus int, expectBody string, interval string) Probe {
+	if expectStatus == 0 {
+		expectStatus = http.StatusOK
+	}
+	expect := fmt.Sprint("status ", expectStatus)
+	if expectBody != "" {
+		expect += ", body contains " + expectBody
+	}
+	return Probe{Name: name, Target: url, TargetInfo: "http", Expect: expect, Interval: interval, Check: func(ctx context.Context) (string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return "", err
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		result := fmt.Sprint("status ", res.StatusCode)
+		if res.StatusCode != expectStatus {
+			return result, fmt.Errorf("unexpected status %d", res.StatusCode)
+		}
+		if expectBody != "" {
+			body, err := io.ReadAll(io.LimitReader(res.Body, 1024*1024))
+			if err != nil {
+				return result, err
+			}
+			if !strings.Contains(string(body), expectBody) {
+				return result, errors.New("body not contains " + expectBody)
+			}
+		}
+		return result, nil
+	}}
+}
+
+// TCPProbe 检查 addr 是否可以建立 TCP 连接
+func TCPProbe(name, addr string, interval string) Probe {
+	return Probe{Name: name, Target: addr, TargetInfo: "tcp", Expect: "connected", Interval: interval, Check: func(ctx context.Context) (string, error) {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return "", err
+		}
+		_ = conn.Close()
+		return "connected", nil
+	}}
+}
+
+// ProbeScheduler 按间隔执行监控检查并记录监控日志，Extra 中的 failures 为连续失败的次数
+type ProbeScheduler struct {
+	logger   *Logger
+	failures map[string]int
+	lock     sync.Mutex
+	stopOnce sync.Once
+	stopChan chan bool
+	wg       sync.WaitGroup
+}
+
+func (logger *Logger) NewProbeScheduler() *ProbeScheduler {
+	return &ProbeScheduler{logger: logger, failures: map[string]int{}, stopChan: make(chan bool)}
+}
+
+// Add 添加监控检查，添加后立即执行一次，之后按间隔执行
+func (s *ProbeScheduler) Add(probe Probe) {
+	interval := parseDurationDefault(probe.Interval, time.Minute)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			s.Run(probe)
+			select {
+			case <-ticker.C:
+			case <-s.stopChan:
+				return
+			}
+		}
+	}()
+}
+
+// Run 立即执行一次监控检查并记录监控日志，返回是否成功
+func (s *ProbeScheduler) Run(probe Probe) bool {
+	timeout := parseDurationDefault(probe.Timeout, 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	startTime := time.Now()
+	result, err := "", errors.New("probe check is nil")
+	if probe.Check != nil {
+		result, err = probe.Check(ctx)
+	}
+	usedTime := MakeUesdTime(startTime, time.Now())
+	memo := ""
+	if err != nil {
+		memo = err.Error()
+	}
+
+	s.lock.Lock()
+	if err != nil {
+		s.failures[probe.Name]++
+	} else {
+		s.failures[probe.Name] = 0
+	}
+	failures := s.failures[probe.Name]
+	s.lock.Unlock()
+
+	s.logger.Monitor(probe.Name, probe.Target, probe.TargetInfo, probe.Expect, result, err == nil, usedTime, memo, "failures", failures)
+	return err == nil
+}
+
+// Failures 返回监控检查连续失败的次数
+func (s *ProbeScheduler) Failures(name string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.failures[name]
+}
+
+// Stop 停止所有监控检查并等待正在执行的检查完成
+func (s *ProbeScheduler) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+	s.wg.Wait()
+}
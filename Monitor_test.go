@@ -0,0 +1,79 @@
+package log_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssgo/log"
+	"github.com/ssgo/u"
+)
+
+func TestProbeScheduler(t *testing.T) {
+	logFile := "tmp_test_monitor.Log"
+	_ = os.Remove(logFile)
+	logger := log.NewLogger(log.Config{File: logFile})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer server.Close()
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := ln.Addr().String()
+	_ = ln.Close()
+
+	s := logger.NewProbeScheduler()
+	if !s.Run(log.HTTPProbe("web", server.URL+"/health", 0, `"ok"`, "")) {
+		t.Error("http probe test failed")
+	}
+	if s.Run(log.HTTPProbe("web2", server.URL+"/health", 0, "fine", "")) {
+		t.Error("http probe body test failed")
+	}
+	if !s.Run(log.TCPProbe("tcp", server.Listener.Addr().String(), "")) || s.Run(log.TCPProbe("tcp2", closedAddr, "")) {
+		t.Error("tcp probe test failed")
+	}
+
+	s.Add(log.HTTPProbe("down", server.URL+"/down", 0, "", "10ms"))
+	s.Add(log.Probe{Name: "custom", Target: "queue", Expect: "empty", Interval: "10ms", Check: func(ctx context.Context) (string, error) {
+		return "3 pending", errors.New("queue not empty")
+	}})
+	// 无效的间隔和超时使用默认值，Check 为 nil 时视为失败
+	s.Add(log.Probe{Name: "invalid", Interval: "0s", Timeout: "abc"})
+	time.Sleep(100 * time.Millisecond)
+	s.Stop()
+	if s.Failures("invalid") != 1 {
+		t.Error("probe invalid test failed", s.Failures("invalid"))
+	}
+	if s.Failures("down") < 3 || s.Failures("custom") < 3 || s.Failures("web") != 0 {
+		t.Error("probe failures test failed", s.Failures("down"), s.Failures("custom"))
+	}
+
+	_, _ = logger.Flush(context.Background())
+	lines, _ := u.ReadFileLines(logFile)
+	text := strings.Join(lines, "\n")
+	for _, s := range []string{
+		`"expect":"status 200, body contains \"ok\""`,
+		`"name":"web","result":"status 200","serverIp"`,
+		`"memo":"body not contains fine"`,
+		`"result":"status 503","serverIp":`,
+		`"memo":"queue not empty","name":"custom","result":"3 pending"`,
+		`\"failures\":3`,
+		`"name":"tcp","result":"connected"`,
+		`"memo":"probe check is nil","name":"invalid"`,
+	} {
+		if !strings.Contains(text, s) {
+			t.Error("monitor log test failed", s)
+		}
+	}
+	_ = os.Remove(logFile)
+}
@@ -0,0 +1,315 @@
+package log
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ssgo/u"
+)
+
+// OpenTelemetry 的 severityNumber 和 severityText
+var otlpSeverities = map[LevelType]struct {
+	number int
+	text   string
+}{DEBUG: {5, "DEBUG"}, INFO: {9, "INFO"}, WARNING: {13, "WARN"}, ERROR: {17, "ERROR"}}
+
+// 作为 Resource 属性的日志字段
+var otlpResourceKeys = map[string]string{
+	"logName":    "service.name",
+	"imageName":  "container.image.name",
+	"imageTag":   "container.image.tag",
+	"serverName": "host.name",
+	"serverIp":   "host.ip",
+}
+
+type otlpWriter struct {
+	config   *Config
+	url      string
+	user     string
+	password string
+	compress string
+	retry    int
+	client   *http.Client
+	lock     sync.Mutex
+	records  map[string]*otlpResourceLogs
+	count    int
+}
+
+type otlpKeyValue struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpLogRecord struct {
+	TimeUnixNano         string                 `json:"timeUnixNano"`
+	ObservedTimeUnixNano string                 `json:"observedTimeUnixNano"`
+	SeverityNumber       int                    `json:"severityNumber"`
+	SeverityText         string                 `json:"severityText"`
+	Body                 map[string]interface{} `json:"body"`
+	Attributes           []otlpKeyValue         `json:"attributes,omitempty"`
+	TraceId              string                 `json:"traceId,omitempty"`
+	SpanId               string                 `json:"spanId,omitempty"`
+}
+
+type otlpScopeLogs struct {
+	Scope struct {
+		Name string `json:"name"`
+	} `json:"scope"`
+	LogRecords []*otlpLogRecord `json:"logRecords"`
+}
+
+type otlpResourceLogs struct {
+	Resource struct {
+		Attributes []otlpKeyValue `json:"attributes"`
+	} `json:"resource"`
+	ScopeLogs []*otlpScopeLogs `json:"scopeLogs"`
+}
+
+// otlpWriterMaker 支持 otlp://host:4318 和 otlps://host:4318（https），默认发送到 /v1/logs，
+// 参数：compress=gzip、retry=3、timeout=10s
+func otlpWriterMaker(conf *Config) Writer {
+	w := new(otlpWriter)
+	w.config = conf
+	w.client = new(http.Client)
+	w.records = map[string]*otlpResourceLogs{}
+	otlpUrl, err := url.Parse(conf.File)
+	if err != nil {
+		DefaultLogger.Error(err.Error(), "conf", conf)
+		return nil
+	}
+
+	if otlpUrl.User != nil {
+		w.user = otlpUrl.User.Username()
+		w.password, _ = otlpUrl.User.Password()
+		otlpUrl.User = nil
+	}
+	if otlpUrl.Scheme == "otlps" {
+		otlpUrl.Scheme = "https"
+	} else {
+		otlpUrl.Scheme = "http"
+	}
+
+	q := otlpUrl.Query()
+	w.client.Timeout = 10 * time.Second
+	if timeout := q.Get("timeout"); timeout != "" {
+		w.client.Timeout = u.Duration(timeout)
+	}
+	w.compress = strings.ToLower(q.Get("compress"))
+	if w.compress != "" && w.compress != "gzip" {
+		DefaultLogger.Error("unsupported otlp compress "+w.compress, "conf", conf)
+		w.compress = ""
+	}
+	w.retry = 3
+	if retry := q.Get("retry"); retry != "" {
+		w.retry = u.Int(retry)
+	}
+
+	if otlpUrl.Path == "" || otlpUrl.Path == "/" {
+		otlpUrl.Path = "/v1/logs"
+	}
+	otlpUrl.RawQuery = ""
+	w.url = otlpUrl.String()
+	return w
+}
+
+// otlpValue 转换为 OpenTelemetry 的 AnyValue
+func otlpValue(v interface{}) map[string]interface{} {
+	switch value := v.(type) {
+	case string:
+		return map[string]interface{}{"stringValue": value}
+	case bool:
+		return map[string]interface{}{"boolValue": value}
+	case json.Number:
+		if _, err := value.Int64(); err == nil {
+			return map[string]interface{}{"intValue": value.String()}
+		}
+		f, _ := value.Float64()
+		return map[string]interface{}{"doubleValue": f}
+	case []interface{}:
+		values := make([]map[string]interface{}, 0, len(value))
+		for _, item := range value {
+			values = append(values, otlpValue(item))
+		}
+		return map[string]interface{}{"arrayValue": map[string]interface{}{"values": values}}
+	case map[string]interface{}:
+		return map[string]interface{}{"kvlistValue": map[string]interface{}{"values": otlpAttributes(value)}}
+	case nil:
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{"stringValue": u.String(v)}
+}
+
+// otlpAttributes 按 Key 排序转换为 OpenTelemetry 的属性列表
+func otlpAttributes(m map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]otlpKeyValue, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, otlpKeyValue{Key: k, Value: otlpValue(m[k])})
+	}
+	return out
+}
+
+// Log 将日志转换为 LogRecord，消息作为 Body，Extra 和其他字段作为属性，镜像和服务器信息作为 Resource 属性
+func (w *otlpWriter) Log(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	fields := map[string]interface{}{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if decoder.Decode(&fields) != nil {
+		fields = map[string]interface{}{"undefined": string(data)}
+	}
+	for k, v := range fields {
+		// 兼容首字母大写的 Key
+		if k == "" {
+			continue
+		}
+		if lk := strings.ToLower(k[0:1]) + k[1:]; lk != k {
+			delete(fields, k)
+			fields[lk] = v
+		}
+	}
+
+	level := getLogLevel(map[string]interface{}{"logType": u.String(fields["logType"])})
+	severity := otlpSeverities[level]
+	record := &otlpLogRecord{
+		TimeUnixNano:         strconv.FormatInt(getLogTime(data).UnixNano(), 10),
+		ObservedTimeUnixNano: strconv.FormatInt(time.Now().UnixNano(), 10),
+		SeverityNumber:       severity.number,
+		SeverityText:         severity.text,
+	}
+	delete(fields, "logTime")
+
+	if traceId := u.String(fields["traceId"]); isTraceHex(traceId, 32) {
+		record.TraceId = traceId
+		delete(fields, "traceId")
+	}
+	if spanId := u.String(fields["spanId"]); isTraceHex(spanId, 16) {
+		record.SpanId = spanId
+		delete(fields, "spanId")
+	}
+
+	resource := map[string]interface{}{}
+	for k, rk := range otlpResourceKeys {
+		if v := u.String(fields[k]); v != "" {
+			resource[rk] = v
+		}
+		delete(fields, k)
+	}
+
+	body := ""
+	for _, k := range []string{"error", "warning", "info", "debug"} {
+		if v, ok := fields[k].(string); ok {
+			body = v
+			delete(fields, k)
+			break
+		}
+	}
+	if body == "" {
+		body = u.String(fields["logType"])
+	}
+	record.Body = otlpValue(body)
+
+	// Extra 在日志中是 JSON 字符串，展开为属性
+	if extra, ok := fields["extra"].(string); ok {
+		delete(fields, "extra")
+		extraFields := map[string]interface{}{}
+		decoder := json.NewDecoder(strings.NewReader(extra))
+		decoder.UseNumber()
+		if decoder.Decode(&extraFields) == nil {
+			for k, v := range extraFields {
+				if _, exists := fields[k]; !exists {
+					fields[k] = v
+				}
+			}
+		}
+	}
+	record.Attributes = otlpAttributes(fields)
+
+	resourceAttributes := otlpAttributes(resource)
+	resourceKey := u.String(resourceAttributes)
+	w.lock.Lock()
+	rl := w.records[resourceKey]
+	if rl == nil {
+		rl = &otlpResourceLogs{}
+		rl.Resource.Attributes = resourceAttributes
+		rl.ScopeLogs = []*otlpScopeLogs{{}}
+		rl.ScopeLogs[0].Scope.Name = "github.com/ssgo/log"
+		w.records[resourceKey] = rl
+	}
+	rl.ScopeLogs[0].LogRecords = append(rl.ScopeLogs[0].LogRecords, record)
+	w.count++
+	w.lock.Unlock()
+}
+
+// Run 由写入队列调用，发送缓存的日志
+func (w *otlpWriter) Run() {
+	_, _ = w.flush(context.Background())
+}
+
+// Flush 按期限发送缓存的日志，返回发送失败的日志数量
+func (w *otlpWriter) Flush(ctx context.Context) (int, error) {
+	return w.flush(ctx)
+}
+
+func (w *otlpWriter) Close(ctx context.Context) (int, error) {
+	return w.flush(ctx)
+}
+
+func (w *otlpWriter) flush(ctx context.Context) (int, error) {
+	w.lock.Lock()
+	records := w.records
+	count := w.count
+	w.records = map[string]*otlpResourceLogs{}
+	w.count = 0
+	w.lock.Unlock()
+	if count == 0 {
+		return 0, nil
+	}
+
+	body := struct {
+		ResourceLogs []*otlpResourceLogs `json:"resourceLogs"`
+	}{ResourceLogs: make([]*otlpResourceLogs, 0, len(records))}
+	for _, rl := range records {
+		body.ResourceLogs = append(body.ResourceLogs, rl)
+	}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return count, err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	if w.compress == "gzip" {
+		buf := new(bytes.Buffer)
+		gz := gzip.NewWriter(buf)
+		_, _ = gz.Write(data)
+		_ = gz.Close()
+		data = buf.Bytes()
+		header.Set("Content-Encoding", "gzip")
+	}
+	if w.user != "" {
+		header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(w.user+":"+w.password)))
+	}
+	if err = postWithRetry(ctx, w.client, w.url, data, header, w.retry); err == nil {
+		return 0, nil
+	}
+	log.Println("otlp sent failed", err.Error(), count)
+	return count, err
+}
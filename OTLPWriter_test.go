@@ -0,0 +1,104 @@
+package log_test
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ssgo/log"
+)
+
+type otlpKeyValue struct {
+	Key   string
+	Value map[string]interface{}
+}
+
+type otlpExport struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpKeyValue
+		}
+		ScopeLogs []struct {
+			LogRecords []struct {
+				TimeUnixNano   string
+				SeverityNumber int
+				SeverityText   string
+				Body           map[string]interface{}
+				Attributes     []otlpKeyValue
+				TraceId        string
+				SpanId         string
+			}
+		}
+	}
+}
+
+func otlpAttr(attrs []otlpKeyValue, key string) interface{} {
+	for _, a := range attrs {
+		if a.Key == key {
+			for _, v := range a.Value {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+func TestOTLPWriter(t *testing.T) {
+	lock := sync.Mutex{}
+	exports := make([]otlpExport, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/logs" || r.Header.Get("Content-Type") != "application/json" || r.Header.Get("Content-Encoding") != "gzip" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		gz, _ := gzip.NewReader(r.Body)
+		body, _ := io.ReadAll(gz)
+		export := otlpExport{}
+		if err := json.Unmarshal(body, &export); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		exports = append(exports, export)
+		lock.Unlock()
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	logger := log.NewLogger(log.Config{Name: "appOtel", File: strings.Replace(server.URL, "http://", "otlp://", 1) + "?compress=gzip", FlushInterval: "10ms"})
+	traceId := log.NewTraceId()
+	spanId := log.NewSpanId()
+	logger.NewSpan(traceId, spanId).Error("db down", "retry", 3, "ok", false)
+	logger.New("req-1").Info("hello")
+	if lost, err := logger.Flush(context.Background()); lost != 0 || err != nil {
+		t.Fatal("otlp flush failed", lost, err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(exports) != 1 || len(exports[0].ResourceLogs) != 1 || len(exports[0].ResourceLogs[0].ScopeLogs[0].LogRecords) != 2 {
+		t.Fatal("otlp export test failed", exports)
+	}
+	rl := exports[0].ResourceLogs[0]
+	if otlpAttr(rl.Resource.Attributes, "service.name") != "appOtel" || otlpAttr(rl.Resource.Attributes, "host.name") == nil {
+		t.Error("otlp resource test failed", rl.Resource.Attributes)
+	}
+	records := rl.ScopeLogs[0].LogRecords
+	r := records[0]
+	if r.SeverityNumber != 17 || r.SeverityText != "ERROR" || r.Body["stringValue"] != "db down" || r.TraceId != traceId || r.SpanId != spanId || len(r.TimeUnixNano) < 19 {
+		t.Error("otlp record test failed", r)
+	}
+	if otlpAttr(r.Attributes, "retry") != "3" || otlpAttr(r.Attributes, "ok") != false || otlpAttr(r.Attributes, "logType") != "error" || otlpAttr(r.Attributes, "callStacks") == nil {
+		t.Error("otlp attributes test failed", r.Attributes)
+	}
+	r = records[1]
+	if r.SeverityNumber != 9 || r.SeverityText != "INFO" || r.TraceId != "" || otlpAttr(r.Attributes, "traceId") != "req-1" {
+		t.Error("otlp info test failed", r)
+	}
+}
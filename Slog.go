@@ -0,0 +1,152 @@
+package log
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/ssgo/standard"
+)
+
+// SlogHandler 将 log/slog 的日志写入 Logger，分组对应 Extra 中的嵌套 map，WithAttrs 的字段会附加到之后的每一条日志
+type SlogHandler struct {
+	logger *Logger
+	extra  map[string]interface{}
+	groups []string
+}
+
+func NewSlogHandler(logger *Logger) *SlogHandler {
+	return &SlogHandler{logger: logger, extra: map[string]interface{}{}}
+}
+
+// slogLevel 将 slog 的级别转换为日志级别
+func slogLevel(level slog.Level) LevelType {
+	if level < slog.LevelInfo {
+		return DEBUG
+	} else if level < slog.LevelWarn {
+		return INFO
+	} else if level < slog.LevelError {
+		return WARNING
+	}
+	return ERROR
+}
+
+func (h *SlogHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.logger.CheckLevel(slogLevel(level))
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	extra := cloneExtra(h.extra)
+	if r.NumAttrs() > 0 {
+		to := groupMap(extra, h.groups)
+		r.Attrs(func(a slog.Attr) bool {
+			addSlogAttr(to, a)
+			return true
+		})
+	}
+
+	logger := h.logger
+	if cl := contextLogger(ctx); cl != nil && cl != logger {
+		// 使用 Context 中的 traceId 和绑定字段
+		l2 := *logger
+		l2.traceId = cl.traceId
+		l2.spanId = cl.spanId
+		l2.traceState = cl.traceState
+		l2.traceFlags = cl.traceFlags
+		l2.fields = cl.fields
+		logger = &l2
+	}
+	logger = withSpanContext(ctx, logger)
+	switch slogLevel(r.Level) {
+	case DEBUG:
+		logger.Log(logger.MakeDebugLog(standard.LogTypeDebug, r.Message, extra))
+	case INFO:
+		logger.Log(logger.MakeInfoLog(standard.LogTypeInfo, r.Message, extra))
+	case WARNING:
+		logger.Log(logger.MakeWarningLog(standard.LogTypeWarning, r.Message, extra))
+	default:
+		logger.Log(logger.MakeErrorLog(standard.LogTypeError, r.Message, extra))
+	}
+	return nil
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	h2 := *h
+	h2.extra = cloneExtra(h.extra)
+	to := groupMap(h2.extra, h.groups)
+	for _, a := range attrs {
+		addSlogAttr(to, a)
+	}
+	return &h2
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.groups = append(append([]string{}, h.groups...), name)
+	return &h2
+}
+
+// groupMap 返回分组对应的嵌套 map，不存在时创建
+func groupMap(extra map[string]interface{}, groups []string) map[string]interface{} {
+	to := extra
+	for _, g := range groups {
+		sub, ok := to[g].(map[string]interface{})
+		if !ok {
+			sub = map[string]interface{}{}
+			to[g] = sub
+		}
+		to = sub
+	}
+	return to
+}
+
+// cloneExtra 复制嵌套的 map，避免子 Handler 修改父 Handler 的字段
+func cloneExtra(extra map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(extra))
+	for k, v := range extra {
+		if sub, ok := v.(map[string]interface{}); ok {
+			out[k] = cloneExtra(sub)
+		} else {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+func addSlogAttr(to map[string]interface{}, a slog.Attr) {
+	v := a.Value.Resolve()
+	if v.Kind() == slog.KindGroup {
+		attrs := v.Group()
+		if len(attrs) == 0 {
+			return
+		}
+		sub := to
+		if a.Key != "" {
+			sub = groupMap(to, []string{a.Key})
+		}
+		for _, ga := range attrs {
+			addSlogAttr(sub, ga)
+		}
+		return
+	}
+	if a.Key == "" {
+		return
+	}
+	switch v.Kind() {
+	case slog.KindTime:
+		to[a.Key] = MakeLogTime(v.Time())
+	case slog.KindDuration:
+		to[a.Key] = v.Duration().String()
+	default:
+		if err, ok := v.Any().(error); ok {
+			to[a.Key] = err.Error()
+		} else {
+			to[a.Key] = v.Any()
+		}
+	}
+}
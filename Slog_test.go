@@ -0,0 +1,42 @@
+package log_test
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssgo/log"
+	"github.com/ssgo/u"
+)
+
+func TestSlogHandler(t *testing.T) {
+	logFile := "tmp_test_slog.Log"
+	logFile1 := logFile + "." + time.Now().Format("20060102")
+	_ = os.Remove(logFile1)
+	logger := log.NewLogger(log.Config{
+		File:      logFile,
+		SplitTag:  "20060102",
+		Sensitive: "password",
+	})
+
+	sl := slog.New(log.NewSlogHandler(logger)).With("tenant", "t1").WithGroup("req")
+	sl.Debug("slog debug")
+	sl.Info("slog info", "password", "abcd1234", "id", 3)
+	sl.Error("slog error", slog.Group("db", "table", "users"))
+	_, _ = logger.Flush(context.Background())
+
+	lines, _ := u.ReadFileLines(logFile1)
+	if len(lines) != 3 {
+		t.Fatal("slog level test failed", len(lines))
+	}
+	if !strings.Contains(lines[0], `"info":"slog info"`) || !strings.Contains(lines[0], `\"tenant\":\"t1\"`) || !strings.Contains(lines[0], `\"req\":{\"id\":3,\"password\":\"ab****34\"}`) {
+		t.Error("slog info test failed", lines[0])
+	}
+	if !strings.Contains(lines[1], `"error":"slog error"`) || !strings.Contains(lines[1], `\"req\":{\"db\":{\"table\":\"users\"}}`) {
+		t.Error("slog error test failed", lines[1])
+	}
+	_ = os.Remove(logFile1)
+}
@@ -1,8 +1,13 @@
 package log
 
 import (
-	"github.com/ssgo/standard"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
 	"time"
+
+	"github.com/ssgo/standard"
 )
 
 func (logger *Logger) Statistic(serverId, app, name string, startTime, endTime time.Time, times, failed uint, avg, min, max float64, extra ...interface{}) {
@@ -28,3 +33,143 @@ func (logger *Logger) MakeStatisticLog(logType, serverId, app, name string, star
 		Max:       max,
 	}
 }
+
+type StatOptions struct {
+	ServerId   string
+	App        string // 应用名称，默认使用 Config.Name
+	Interval   string // 输出统计日志的间隔，默认 1m
+	MaxSamples int    // 每个统计项用于计算百分位数的最大样本数，超过时随机抽样，默认 10000
+}
+
+// StatCollector 按统计项汇总耗时（毫秒），每个间隔为每个统计项输出一条统计日志，Extra 中包含 p50、p90、p99
+type StatCollector struct {
+	logger     *Logger
+	options    StatOptions
+	maxSamples int
+	startTime  time.Time
+	items      map[string]*statItem
+	lock       sync.Mutex
+	stopOnce   sync.Once
+	stopChan   chan bool
+	doneChan   chan bool
+}
+
+type statItem struct {
+	times   uint
+	failed  uint
+	total   float64
+	min     float64
+	max     float64
+	samples []float64
+}
+
+// NewStatCollector 创建统计收集器并开始定时输出，不再使用时需要调用 Stop
+func (logger *Logger) NewStatCollector(options StatOptions) *StatCollector {
+	if options.App == "" {
+		options.App = logger.config.Name
+	}
+	interval := parseDurationDefault(options.Interval, time.Minute)
+	s := &StatCollector{
+		logger:     logger,
+		options:    options,
+		maxSamples: options.MaxSamples,
+		startTime:  time.Now(),
+		items:      map[string]*statItem{},
+		stopChan:   make(chan bool),
+		doneChan:   make(chan bool),
+	}
+	if s.maxSamples <= 0 {
+		s.maxSamples = 10000
+	}
+	go s.run(interval)
+	return s
+}
+
+// Observe 记录一次调用的耗时和是否成功
+func (s *StatCollector) Observe(name string, duration time.Duration, ok bool) {
+	v := float64(duration) / float64(time.Millisecond)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	item := s.items[name]
+	if item == nil {
+		item = &statItem{min: v, max: v}
+		s.items[name] = item
+	}
+	item.times++
+	if !ok {
+		item.failed++
+	}
+	item.total += v
+	if v < item.min {
+		item.min = v
+	}
+	if v > item.max {
+		item.max = v
+	}
+	if len(item.samples) < s.maxSamples {
+		item.samples = append(item.samples, v)
+	} else if i := rand.Int63n(int64(item.times)); i < int64(s.maxSamples) {
+		item.samples[i] = v
+	}
+}
+
+// Flush 立即输出当前间隔内的统计日志并开始新的间隔
+func (s *StatCollector) Flush() {
+	s.lock.Lock()
+	items := s.items
+	startTime := s.startTime
+	s.items = map[string]*statItem{}
+	s.startTime = time.Now()
+	s.lock.Unlock()
+
+	names := make([]string, 0, len(items))
+	for name := range items {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		item := items[name]
+		sort.Float64s(item.samples)
+		s.logger.Statistic(s.options.ServerId, s.options.App, name, startTime, s.startTime, item.times, item.failed,
+			item.total/float64(item.times), item.min, item.max, map[string]interface{}{
+				"p50": percentile(item.samples, 0.5),
+				"p90": percentile(item.samples, 0.9),
+				"p99": percentile(item.samples, 0.99),
+			})
+	}
+}
+
+// Stop 停止定时输出，并输出剩余的统计日志
+func (s *StatCollector) Stop() {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+	<-s.doneChan
+}
+
+func (s *StatCollector) run(interval time.Duration) {
+	defer close(s.doneChan)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.stopChan:
+			s.Flush()
+			return
+		}
+	}
+}
+
+// percentile 使用最近秩法计算已排序样本的百分位数
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
@@ -0,0 +1,202 @@
+package log
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ssgo/u"
+)
+
+var syslogFacilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// syslog 的 severity
+var syslogSeverities = map[LevelType]int{DEBUG: 7, INFO: 6, WARNING: 4, ERROR: 3}
+
+// 结构化数据使用的私有企业编号（RFC 5612 中保留用于文档和示例）
+const syslogSdId = "trace@32473"
+
+type syslogWriter struct {
+	config   *Config
+	network  string
+	addr     string
+	facility int
+	octet    bool // 使用 octet-counting 分帧，否则使用换行分帧，只对 TCP 有效
+	timeout  time.Duration
+	hostname string
+	appName  string
+	procId   string
+	conn     net.Conn
+	lock     sync.Mutex
+	queue    [][]byte
+}
+
+// syslogWriterMaker 支持 syslog://host:514（UDP）、syslog+tcp://host:514（TCP）、unixgram:///dev/log，
+// 参数：facility=local0（默认 user）、framing=octet|lf（TCP 默认 octet）、timeout=5s
+func syslogWriterMaker(conf *Config) Writer {
+	w := new(syslogWriter)
+	w.config = conf
+	syslogUrl, err := url.Parse(conf.File)
+	if err != nil {
+		DefaultLogger.Error(err.Error(), "conf", conf)
+		return nil
+	}
+
+	switch syslogUrl.Scheme {
+	case "syslog+tcp":
+		w.network = "tcp"
+		w.addr = syslogUrl.Host
+	case "unixgram":
+		w.network = "unixgram"
+		w.addr = syslogUrl.Path
+	default:
+		w.network = "udp"
+		w.addr = syslogUrl.Host
+	}
+	if w.network != "unixgram" && syslogUrl.Port() == "" {
+		w.addr = net.JoinHostPort(syslogUrl.Hostname(), "514")
+	}
+
+	q := syslogUrl.Query()
+	w.facility = 1
+	if facility := q.Get("facility"); facility != "" {
+		if f, ok := syslogFacilities[strings.ToLower(facility)]; ok {
+			w.facility = f
+		} else if f, err := strconv.Atoi(facility); err == nil && f >= 0 && f <= 23 {
+			w.facility = f
+		} else {
+			DefaultLogger.Error("unsupported syslog facility "+facility, "conf", conf)
+		}
+	}
+	w.octet = w.network == "tcp" && q.Get("framing") != "lf"
+	w.timeout = 5 * time.Second
+	if timeout := q.Get("timeout"); timeout != "" {
+		w.timeout = u.Duration(timeout)
+	}
+
+	w.hostname = syslogHeaderValue(serverName, 255)
+	w.appName = syslogHeaderValue(conf.Name, 48)
+	w.procId = strconv.Itoa(os.Getpid())
+	w.queue = make([][]byte, 0)
+	return w
+}
+
+// syslogHeaderValue 将值转换为 syslog 头中可用的可打印 ASCII 字符，为空时使用 -
+func syslogHeaderValue(s string, maxLen int) string {
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s) && len(buf) < maxLen; i++ {
+		if s[i] > 32 && s[i] < 127 {
+			buf = append(buf, s[i])
+		}
+	}
+	if len(buf) == 0 {
+		return "-"
+	}
+	return string(buf)
+}
+
+// syslogParamReplacer 转义结构化数据中的参数值
+var syslogParamReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// format 使用 RFC 5424 的格式封装日志
+func (w *syslogWriter) format(data []byte) []byte {
+	severity, ok := syslogSeverities[getDataLevel(data)]
+	if !ok {
+		severity = 6
+	}
+	msgId := syslogHeaderValue(getLogField(data, "logType"), 32)
+	sd := "-"
+	if traceId := getLogField(data, "traceId"); traceId != "" {
+		sd = "[" + syslogSdId + " traceId=\"" + syslogParamReplacer.Replace(traceId) + "\""
+		if spanId := getLogField(data, "spanId"); spanId != "" {
+			sd += " spanId=\"" + syslogParamReplacer.Replace(spanId) + "\""
+		}
+		sd += "]"
+	}
+	header := fmt.Sprintf("<%d>1 %s %s %s %s %s %s ", w.facility*8+severity, getLogTime(data).Format("2006-01-02T15:04:05.000000Z07:00"),
+		w.hostname, w.appName, w.procId, msgId, sd)
+	return append([]byte(header), data...)
+}
+
+func (w *syslogWriter) Log(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	msg := w.format(data)
+	w.lock.Lock()
+	w.queue = append(w.queue, msg)
+	w.lock.Unlock()
+}
+
+// Run 由写入队列调用，发送队列中的日志，TCP 连接出错时重新连接并重试一次
+func (w *syslogWriter) Run() {
+	w.lock.Lock()
+	sendings := w.queue
+	w.queue = make([][]byte, 0)
+	w.lock.Unlock()
+	if len(sendings) == 0 {
+		return
+	}
+
+	var err error
+	for retry := 0; retry < 2; retry++ {
+		if err = w.send(sendings); err == nil {
+			return
+		}
+		w.closeConn()
+		if w.network != "tcp" {
+			break
+		}
+	}
+	log.Println("syslog sent failed", err.Error(), len(sendings))
+}
+
+func (w *syslogWriter) send(sendings [][]byte) error {
+	if w.conn == nil {
+		conn, err := net.DialTimeout(w.network, w.addr, w.timeout)
+		if err != nil {
+			return err
+		}
+		w.conn = conn
+	}
+	_ = w.conn.SetWriteDeadline(time.Now().Add(w.timeout))
+
+	if w.network != "tcp" {
+		// 数据报每条日志单独发送
+		for len(sendings) > 0 {
+			if _, err := w.conn.Write(sendings[0]); err != nil {
+				return err
+			}
+			sendings = sendings[1:]
+		}
+		return nil
+	}
+
+	buf := make([]byte, 0, 4096)
+	for _, msg := range sendings {
+		if w.octet {
+			buf = append(append(strconv.AppendInt(buf, int64(len(msg)), 10), ' '), msg...)
+		} else {
+			buf = append(append(buf, msg...), '\n')
+		}
+	}
+	_, err := w.conn.Write(buf)
+	return err
+}
+
+func (w *syslogWriter) closeConn() {
+	if w.conn != nil {
+		_ = w.conn.Close()
+		w.conn = nil
+	}
+}
@@ -0,0 +1,102 @@
+package log_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssgo/log"
+)
+
+var syslogMatcher = regexp.MustCompile(`^<(\d+)>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}\S+ \S+ appSys \d+ (\S+) (-|\[[^\]]*\]) (\{.*\})$`)
+
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	logger := log.NewLogger(log.Config{Name: "appSys", File: "syslog://" + pc.LocalAddr().String() + "?facility=local0", FlushInterval: "10ms"})
+	logger.New("trace1").Error("disk full")
+	logger.Info("started")
+	_, _ = logger.Flush(context.Background())
+
+	buf := make([]byte, 65536)
+	results := make([][]string, 0)
+	for i := 0; i < 2; i++ {
+		_ = pc.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := syslogMatcher.FindStringSubmatch(string(buf[0:n]))
+		if m == nil {
+			t.Fatal("syslog format test failed", string(buf[0:n]))
+		}
+		results = append(results, m)
+	}
+	// local0(16)*8 + err(3)、info(6)
+	if results[0][1] != "131" || results[0][2] != "error" || results[0][3] != `[trace@32473 traceId="trace1"]` || !strings.Contains(results[0][4], `"error":"disk full"`) {
+		t.Error("syslog error test failed", results[0])
+	}
+	if results[1][1] != "134" || results[1][2] != "info" || results[1][3] != "-" {
+		t.Error("syslog info test failed", results[1])
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan string, 10)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			// octet-counting：长度 空格 消息
+			size, err := reader.ReadString(' ')
+			if err != nil {
+				return
+			}
+			n := 0
+			for _, c := range strings.TrimSpace(size) {
+				n = n*10 + int(c-'0')
+			}
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(reader, msg); err != nil {
+				return
+			}
+			received <- string(msg)
+		}
+	}()
+
+	logger := log.NewLogger(log.Config{Name: "appSys", File: "syslog+tcp://" + ln.Addr().String(), FlushInterval: "10ms"})
+	logger.Warning("slow")
+	logger.Debug("hidden")
+	logger.Info("line1\nline2")
+	_, _ = logger.Flush(context.Background())
+
+	for _, expect := range []string{`"warning":"slow"`, `"info":"line1\nline2"`} {
+		select {
+		case msg := <-received:
+			m := syslogMatcher.FindStringSubmatch(msg)
+			if m == nil || !strings.Contains(m[4], expect) {
+				t.Error("syslog tcp test failed", expect, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("syslog tcp receive timeout", expect)
+		}
+	}
+}
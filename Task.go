@@ -1,8 +1,11 @@
 package log
 
 import (
-	"github.com/ssgo/standard"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/ssgo/standard"
 )
 
 func (logger *Logger) Task(name string, args map[string]interface{}, succeed bool, node string, startTime time.Time, usedTime float32, memo string, extra ...interface{}) {
@@ -13,6 +16,25 @@ func (logger *Logger) Task(name string, args map[string]interface{}, succeed boo
 	logger.Log(logger.MakeTaskLog(standard.LogTypeTask, name, args, succeed, node, startTime, usedTime, memo, extra...))
 }
 
+// RunTask 执行任务并记录任务日志，返回错误或发生 panic 时记为失败，panic 的调用栈记录在 memo 中并作为错误返回
+func (logger *Logger) RunTask(name string, args map[string]interface{}, task func() error, extra ...interface{}) (err error) {
+	startTime := time.Now()
+	memo := ""
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+			memo = err.Error() + "\n" + strings.Join(logger.getCallStacks(), "\n")
+		}
+		logger.Task(name, args, err == nil, serverIp, startTime, MakeUesdTime(startTime, time.Now()), memo, extra...)
+	}()
+
+	err = task()
+	if err != nil {
+		memo = err.Error()
+	}
+	return err
+}
+
 func (logger *Logger) MakeTaskLog(logType, name string, args map[string]interface{}, succeed bool, node string, startTime time.Time, usedTime float32, memo string, extra ...interface{}) standard.TaskLog {
 	return standard.TaskLog{
 		BaseLog:   logger.MakeBaseLog(logType, extra...),
@@ -0,0 +1,153 @@
+package log
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const HeaderTraceParent = "traceparent"
+const HeaderTraceState = "tracestate"
+
+// TraceParent W3C Trace Context 中的 traceparent，格式为 00-{traceId}-{spanId}-{flags}
+type TraceParent struct {
+	TraceId string // 32位十六进制
+	SpanId  string // 16位十六进制
+	Flags   byte   // 01 表示已采样
+}
+
+func (tp TraceParent) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", tp.TraceId, tp.SpanId, tp.Flags)
+}
+
+// ParseTraceParent 解析 traceparent，格式不正确时返回 false
+func ParseTraceParent(s string) (TraceParent, bool) {
+	tp := TraceParent{}
+	a := strings.Split(strings.TrimSpace(s), "-")
+	if len(a) < 4 || len(a[0]) != 2 || a[0] == "ff" || (a[0] == "00" && len(a) != 4) {
+		return tp, false
+	}
+	if !isTraceHex(a[1], 32) || !isTraceHex(a[2], 16) || !isTraceHex(a[3], 2) {
+		return tp, false
+	}
+	flags, _ := hex.DecodeString(a[3])
+	tp.TraceId = a[1]
+	tp.SpanId = a[2]
+	tp.Flags = flags[0]
+	return tp, true
+}
+
+// isTraceHex 判断是否为指定长度的小写十六进制字符串且不全为0
+func isTraceHex(s string, size int) bool {
+	if len(s) != size {
+		return false
+	}
+	allZero := true
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+		if c != '0' {
+			allZero = false
+		}
+	}
+	return !allZero || size == 2
+}
+
+func randomHex(size int) string {
+	buf := make([]byte, size)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// NewTraceId 生成符合 W3C Trace Context 的 traceId
+func NewTraceId() string {
+	return randomHex(16)
+}
+
+// NewSpanId 生成符合 W3C Trace Context 的 spanId
+func NewSpanId() string {
+	return randomHex(8)
+}
+
+// ExtractTraceContext 从 HTTP 头中读取 traceparent 和 tracestate
+func ExtractTraceContext(header http.Header) (TraceParent, string, bool) {
+	tp, ok := ParseTraceParent(header.Get(HeaderTraceParent))
+	if !ok {
+		return tp, "", false
+	}
+	return tp, header.Get(HeaderTraceState), true
+}
+
+// InjectTraceContext 将 traceparent 和 tracestate 写入 HTTP 头，traceId、spanId 不符合规范时不写入
+func InjectTraceContext(header http.Header, tp TraceParent, traceState string) {
+	if !isTraceHex(tp.TraceId, 32) || !isTraceHex(tp.SpanId, 16) {
+		return
+	}
+	header.Set(HeaderTraceParent, tp.String())
+	if traceState != "" {
+		header.Set(HeaderTraceState, traceState)
+	}
+}
+
+// NewSpan 返回使用指定 traceId、spanId 的子 Logger，traceId 改变时不延续原链路的 tracestate 和采样标记
+func (logger *Logger) NewSpan(traceId, spanId string) *Logger {
+	newLogger := *logger
+	if traceId != logger.traceId {
+		newLogger.traceState = ""
+		newLogger.traceFlags = 0
+	}
+	newLogger.traceId = traceId
+	newLogger.spanId = spanId
+	return &newLogger
+}
+
+func (logger *Logger) GetSpanId() string {
+	return logger.spanId
+}
+
+func (logger *Logger) GetTraceState() string {
+	return logger.traceState
+}
+
+// FromHeader 返回延续 HTTP 头中 W3C Trace Context 的子 Logger，并为当前服务生成新的 spanId，没有 traceparent 时返回原 Logger
+func (logger *Logger) FromHeader(header http.Header) *Logger {
+	tp, traceState, ok := ExtractTraceContext(header)
+	if !ok {
+		return logger
+	}
+	newLogger := logger.NewSpan(tp.TraceId, NewSpanId())
+	newLogger.traceState = traceState
+	newLogger.traceFlags = tp.Flags
+	return newLogger
+}
+
+// InjectHeader 将当前的 traceId、spanId 以 W3C Trace Context 的格式写入 HTTP 头
+func (logger *Logger) InjectHeader(header http.Header) {
+	InjectTraceContext(header, TraceParent{TraceId: logger.traceId, SpanId: logger.spanId, Flags: logger.traceFlags}, logger.traceState)
+}
+
+// withSpanContext 使用 Context 中 OpenTelemetry Span 的 traceId、spanId
+func withSpanContext(ctx context.Context, logger *Logger) *Logger {
+	if ctx == nil {
+		return logger
+	}
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return logger
+	}
+	traceId := sc.TraceID().String()
+	spanId := sc.SpanID().String()
+	if logger.traceId == traceId && logger.spanId == spanId {
+		return logger
+	}
+	newLogger := logger.NewSpan(traceId, spanId)
+	newLogger.traceState = sc.TraceState().String()
+	newLogger.traceFlags = byte(sc.TraceFlags())
+	return newLogger
+}
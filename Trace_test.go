@@ -0,0 +1,68 @@
+package log_test
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssgo/log"
+	"github.com/ssgo/u"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTraceParent(t *testing.T) {
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set("tracestate", "congo=t61rcWkgMzE")
+	logger := log.NewLogger(log.Config{}).FromHeader(header)
+	if logger.GetTraceId() != "4bf92f3577b34da6a3ce929d0e0e4736" || len(logger.GetSpanId()) != 16 || logger.GetSpanId() == "00f067aa0ba902b7" {
+		t.Error("extract trace context test failed", logger.GetTraceId(), logger.GetSpanId())
+	}
+
+	outHeader := http.Header{}
+	logger.InjectHeader(outHeader)
+	if outHeader.Get("traceparent") != "00-4bf92f3577b34da6a3ce929d0e0e4736-"+logger.GetSpanId()+"-01" || outHeader.Get("tracestate") != "congo=t61rcWkgMzE" {
+		t.Error("inject trace context test failed", outHeader)
+	}
+
+	// New 使用新的 traceId 时不能延续原链路的 spanId 和 tracestate
+	child := logger.New("0af7651916cd43dd8448eb211c80319c")
+	childHeader := http.Header{}
+	child.InjectHeader(childHeader)
+	if child.GetSpanId() != "" || child.GetTraceState() != "" || childHeader.Get("traceparent") != "" || childHeader.Get("tracestate") != "" {
+		t.Error("new trace test failed", child.GetSpanId(), child.GetTraceState(), childHeader)
+	}
+	childHeader = http.Header{}
+	child.NewSpan(child.GetTraceId(), "b7ad6b7169203331").InjectHeader(childHeader)
+	if childHeader.Get("traceparent") != "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-00" || childHeader.Get("tracestate") != "" {
+		t.Error("new trace span test failed", childHeader)
+	}
+
+	for _, bad := range []string{"", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"} {
+		if _, ok := log.ParseTraceParent(bad); ok {
+			t.Error("parse bad traceparent test failed", bad)
+		}
+	}
+}
+
+func TestTraceOpenTelemetry(t *testing.T) {
+	logFile := "tmp_test_trace.Log"
+	logFile1 := logFile + "." + time.Now().Format("20060102")
+	_ = os.Remove(logFile1)
+	logger := log.NewLogger(log.Config{File: logFile, SplitTag: "20060102"})
+
+	traceId, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanId, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx := trace.ContextWithSpanContext(log.NewContext(context.Background(), logger), trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceId, SpanID: spanId, TraceFlags: trace.FlagsSampled}))
+	log.InfoCtx(ctx, "otel test")
+	_, _ = logger.Flush(context.Background())
+
+	lines, _ := u.ReadFileLines(logFile1)
+	if len(lines) != 2 || !strings.Contains(lines[0], `"traceId":"4bf92f3577b34da6a3ce929d0e0e4736"`) || !strings.Contains(lines[0], `"spanId":"00f067aa0ba902b7"`) {
+		t.Error("opentelemetry trace test failed", lines)
+	}
+	_ = os.Remove(logFile1)
+}
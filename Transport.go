@@ -0,0 +1,87 @@
+package log
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ssgo/standard"
+)
+
+const LogTypeOutbound = "outbound" // 对外发起的请求
+
+type TransportOptions struct {
+	App         string // 目标应用名称，默认使用请求的 Host
+	MaxBodySize int    // 记录请求内容的最大长度，默认 0 不记录
+}
+
+type loggerTransport struct {
+	base    http.RoundTripper
+	logger  *Logger
+	options TransportOptions
+}
+
+// Transport 返回记录对外请求日志的 http.RoundTripper，并通过 X-Request-ID 和 traceparent 传递 traceId，请求的 Context 中携带 Logger 时优先使用
+func (logger *Logger) Transport(base http.RoundTripper, options TransportOptions) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &loggerTransport{base: base, logger: logger, options: options}
+}
+
+func (t *loggerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	logger := contextLogger(ctx)
+	if logger == nil {
+		logger = t.logger
+	}
+	logger = withSpanContext(ctx, logger)
+
+	// RoundTripper 不能修改原请求
+	req = req.Clone(ctx)
+	if logger.traceId != "" && req.Header.Get(standard.DiscoverHeaderRequestId) == "" {
+		req.Header.Set(standard.DiscoverHeaderRequestId, logger.traceId)
+	}
+	if req.Header.Get(HeaderTraceParent) == "" {
+		logger.InjectHeader(req.Header)
+	}
+	if req.Header.Get(standard.DiscoverHeaderFromApp) == "" {
+		req.Header.Set(standard.DiscoverHeaderFromApp, logger.config.Name)
+	}
+
+	if !logger.CheckLevel(INFO) {
+		return t.base.RoundTrip(req)
+	}
+
+	requestData := readRequestData(req, t.options.MaxBodySize)
+	requestHeaders := flatHeader(req.Header)
+	startTime := time.Now()
+	res, err := t.base.RoundTrip(req)
+	usedTime := MakeUesdTime(startTime, time.Now())
+
+	toApp := t.options.App
+	if toApp == "" {
+		toApp = req.URL.Hostname()
+	}
+	responseCode := 0
+	var responseHeaders map[string]string
+	var responseDataLength uint
+	responseData := ""
+	if err != nil {
+		responseData = err.Error()
+	} else {
+		responseCode = res.StatusCode
+		responseHeaders = flatHeader(res.Header)
+		if res.ContentLength > 0 {
+			responseDataLength = uint(res.ContentLength)
+		}
+	}
+
+	logger.Log(logger.MakeRequestLog(LogTypeOutbound, "", toApp, req.URL.Host, serverIp,
+		logger.config.Name, serverIp, req.Header.Get(standard.DiscoverHeaderUserId), req.Header.Get(standard.DiscoverHeaderDeviceId),
+		req.Header.Get(standard.DiscoverHeaderClientAppName), req.Header.Get(standard.DiscoverHeaderClientAppVersion),
+		req.Header.Get(standard.DiscoverHeaderSessionId), req.Header.Get(standard.DiscoverHeaderRequestId), req.URL.Host, req.URL.Scheme,
+		strings.TrimPrefix(req.Proto, "HTTP/"), 0, 0, req.Method, req.URL.Path, requestHeaders, requestData, usedTime,
+		responseCode, responseHeaders, responseDataLength, responseData))
+	return res, err
+}
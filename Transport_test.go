@@ -0,0 +1,58 @@
+package log_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ssgo/log"
+	"github.com/ssgo/u"
+)
+
+func TestTransport(t *testing.T) {
+	logFile := "tmp_test_transport.Log"
+	logFile1 := logFile + "." + time.Now().Format("20060102")
+	_ = os.Remove(logFile1)
+	logger := log.NewLogger(log.Config{Name: "appA", File: logFile, SplitTag: "20060102"})
+
+	traceId := log.NewTraceId()
+	var gotHeader http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header.Clone()
+		w.Header().Set("Content-Length", "2")
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: logger.Transport(nil, log.TransportOptions{App: "appB", MaxBodySize: 100})}
+	req, _ := http.NewRequest("POST", server.URL+"/jobs?id=1", strings.NewReader("hello"))
+	req = req.WithContext(log.NewContext(context.Background(), logger.NewSpan(traceId, log.NewSpanId())))
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = res.Body.Close()
+	if req.Header.Get("X-Request-Id") != "" {
+		t.Error("transport modified request")
+	}
+	if gotHeader.Get("X-Request-Id") != traceId || !strings.Contains(gotHeader.Get("traceparent"), traceId) || gotHeader.Get("X-From-App") != "appA" {
+		t.Error("transport header test failed", gotHeader)
+	}
+
+	_, _ = logger.Flush(context.Background())
+	lines, _ := u.ReadFileLines(logFile1)
+	if len(lines) < 1 {
+		t.Fatal("transport log test failed")
+	}
+	for _, s := range []string{`"logType":"outbound"`, `"fromApp":"appA"`, `"app":"appB"`, `"responseCode":202`, `"responseDataLength":2`, `"body":"hello"`, `"id":"1"`, `"traceId":"` + traceId + `"`, `"path":"/jobs"`} {
+		if !strings.Contains(lines[0], s) {
+			t.Error("transport log test failed", s, lines[0])
+		}
+	}
+	_ = os.Remove(logFile1)
+}
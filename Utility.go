@@ -1,9 +1,14 @@
 package log
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/ssgo/standard"
 	"github.com/ssgo/u"
+	"io/ioutil"
+	"net/http"
 	"reflect"
 	"strings"
 	"time"
@@ -122,3 +127,118 @@ func ParseSpecialLog(from *standard.BaseLog, to interface{}) {
 		}
 	}
 }
+
+// ParseSize 解析尺寸，支持 K、M、G 单位，如 100M
+func ParseSize(s string) int64 {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.TrimSuffix(s, "B")
+	if s == "" {
+		return 0
+	}
+	unit := int64(1)
+	switch s[len(s)-1] {
+	case 'K':
+		unit = 1024
+	case 'M':
+		unit = 1024 * 1024
+	case 'G':
+		unit = 1024 * 1024 * 1024
+	}
+	if unit > 1 {
+		s = s[0 : len(s)-1]
+	}
+	return u.Int64(s) * unit
+}
+
+// parseDuration 解析时间长度，在 u.Duration 的基础上支持以天为单位，如 7d
+func parseDuration(s string) time.Duration {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	if strings.HasSuffix(s, "d") {
+		return time.Duration(u.Float64(s[0:len(s)-1]) * float64(24*time.Hour))
+	}
+	return u.Duration(s)
+}
+
+// parseDurationDefault 解析时间长度，未设置、无法解析或不大于0时使用默认值（如 time.NewTicker 不能使用非正数的间隔）
+func parseDurationDefault(s string, defaultValue time.Duration) time.Duration {
+	if d := parseDuration(s); d > 0 {
+		return d
+	}
+	return defaultValue
+}
+
+// getLogField 从序列化后的日志中读取顶层的字符串字段，兼容首字母大写的 Key
+func getLogField(data []byte, key string) string {
+	for _, k := range []string{key, strings.ToUpper(key[0:1]) + key[1:]} {
+		prefix := []byte("\"" + k + "\":\"")
+		pos := bytes.Index(data, prefix)
+		if pos == -1 {
+			continue
+		}
+		v := data[pos+len(prefix):]
+		if end := bytes.IndexByte(v, '"'); end != -1 {
+			return string(v[0:end])
+		}
+	}
+	return ""
+}
+
+// getDataLevel 根据序列化后日志中的 logType 判断日志级别
+func getDataLevel(data []byte) LevelType {
+	return getLogLevel(map[string]interface{}{"logType": getLogField(data, "logType")})
+}
+
+// sleepContext 等待指定的时间，期限先到达时返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// postWithRetry 发送 POST 请求，429、5xx 和网络错误时按指数退避最多重试 retry 次
+func postWithRetry(ctx context.Context, client *http.Client, url string, data []byte, header http.Header, retry int) error {
+	backoff := 100 * time.Millisecond
+	for i := 0; ; i++ {
+		canRetry, err := postData(ctx, client, url, data, header)
+		if err == nil {
+			return nil
+		}
+		if !canRetry || i >= retry || !sleepContext(ctx, backoff) {
+			return err
+		}
+		backoff *= 2
+	}
+}
+
+// postData 发送一次 POST 请求，返回的 retry 表示失败后是否可以重试
+func postData(ctx context.Context, client *http.Client, url string, data []byte, header http.Header) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	result, _ := ioutil.ReadAll(res.Body)
+	_ = res.Body.Close()
+	if res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500 {
+		return true, fmt.Errorf("%s %s", res.Status, string(result))
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return false, fmt.Errorf("%s %s", res.Status, string(result))
+	}
+	return false, nil
+}
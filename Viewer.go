@@ -3,6 +3,7 @@ package log
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"math"
 	"regexp"
 	"strings"
@@ -119,7 +120,7 @@ func Viewable(line string) string {
 		lo.levelKey = "Info"
 	}
 
-	if b.LogType == standard.LogTypeRequest {
+	if b.LogType == standard.LogTypeRequest || b.LogType == LogTypeOutbound {
 		r := standard.RequestLog{}
 		ParseSpecialLog(b, &r)
 		if r.ResponseCode <= 0 || (r.ResponseCode >= 400 && r.ResponseCode <= 599) {
@@ -255,3 +256,10 @@ func Viewable(line string) string {
 	}
 	return strings.Join(outs, "")
 }
+
+// ViewFile 将日志文件转换为可读格式输出，支持压缩的历史日志文件
+func ViewFile(fileName string, out io.Writer) error {
+	return ReadLogFile(fileName, func(line string) {
+		_, _ = fmt.Fprintln(out, Viewable(line))
+	})
+}
@@ -0,0 +1,192 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/ssgo/u"
+)
+
+// webhook 的参数，其他参数保留在请求地址中
+var webhookOptionKeys = []string{"format", "header", "token", "batchSize", "flushInterval", "retry", "timeout", "level", "template"}
+
+type webhookWriter struct {
+	config    *Config
+	url       string
+	header    http.Header
+	format    string // ndjson 或 array
+	template  *template.Template
+	batchSize int
+	level     LevelType
+	retry     int
+	client    *http.Client
+	lock      sync.Mutex
+	queue     [][]byte
+}
+
+// webhookWriterMaker 支持 http:// 和 https://，将日志批量 POST 到指定地址，
+// 参数：format=ndjson|array（默认 ndjson）、header=Name:value（可以多个）、token=xxx（Authorization: Bearer）、
+// batchSize=100（每个请求最多的日志数量）、flushInterval=1s、retry=3、timeout=10s、level=error（只发送该级别及以上的日志）、
+// template=xxx（使用 text/template 生成请求内容，.Logs 为日志列表，json 函数用于输出 JSON）
+func webhookWriterMaker(conf *Config) Writer {
+	w := new(webhookWriter)
+	w.config = conf
+	w.client = new(http.Client)
+	w.header = http.Header{}
+	webhookUrl, err := url.Parse(conf.File)
+	if err != nil {
+		DefaultLogger.Error(err.Error(), "conf", conf)
+		return nil
+	}
+
+	if webhookUrl.User != nil {
+		password, _ := webhookUrl.User.Password()
+		w.header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(webhookUrl.User.Username()+":"+password)))
+		webhookUrl.User = nil
+	}
+
+	q := webhookUrl.Query()
+	w.format = strings.ToLower(q.Get("format"))
+	if w.format != "array" {
+		w.format = "ndjson"
+	}
+	w.header.Set("Content-Type", "application/json")
+	if w.format == "ndjson" {
+		w.header.Set("Content-Type", "application/x-ndjson")
+	}
+	if tpl := q.Get("template"); tpl != "" {
+		w.template, err = template.New("webhook").Funcs(template.FuncMap{"json": func(v interface{}) string {
+			buf, _ := json.Marshal(v)
+			return string(buf)
+		}}).Parse(tpl)
+		if err != nil {
+			DefaultLogger.Error(err.Error(), "conf", conf)
+			return nil
+		}
+		w.header.Set("Content-Type", "application/json")
+	}
+	for _, h := range q["header"] {
+		if a := strings.SplitN(h, ":", 2); len(a) == 2 {
+			w.header.Add(strings.TrimSpace(a[0]), strings.TrimSpace(a[1]))
+		}
+	}
+	if token := q.Get("token"); token != "" {
+		w.header.Set("Authorization", "Bearer "+token)
+	}
+
+	w.batchSize = u.Int(q.Get("batchSize"))
+	if w.batchSize > 0 && conf.FlushSize <= 0 {
+		conf.FlushSize = w.batchSize
+	}
+	if flushInterval := q.Get("flushInterval"); flushInterval != "" && conf.FlushInterval == "" {
+		conf.FlushInterval = flushInterval
+	}
+	w.retry = 3
+	if retry := q.Get("retry"); retry != "" {
+		w.retry = u.Int(retry)
+	}
+	w.client.Timeout = 10 * time.Second
+	if timeout := q.Get("timeout"); timeout != "" {
+		w.client.Timeout = u.Duration(timeout)
+	}
+	switch strings.ToLower(q.Get("level")) {
+	case "info":
+		w.level = INFO
+	case "warning":
+		w.level = WARNING
+	case "error":
+		w.level = ERROR
+	default:
+		w.level = DEBUG
+	}
+
+	for _, k := range webhookOptionKeys {
+		q.Del(k)
+	}
+	webhookUrl.RawQuery = q.Encode()
+	w.url = webhookUrl.String()
+	w.queue = make([][]byte, 0)
+	return w
+}
+
+func (w *webhookWriter) Log(data []byte) {
+	if len(data) == 0 || (w.level > DEBUG && getDataLevel(data) < w.level) {
+		return
+	}
+	w.lock.Lock()
+	w.queue = append(w.queue, append([]byte{}, data...))
+	w.lock.Unlock()
+}
+
+// Run 由写入队列调用，发送缓存的日志
+func (w *webhookWriter) Run() {
+	_, _ = w.flush(context.Background())
+}
+
+// Flush 按期限发送缓存的日志，返回发送失败的日志数量
+func (w *webhookWriter) Flush(ctx context.Context) (int, error) {
+	return w.flush(ctx)
+}
+
+func (w *webhookWriter) Close(ctx context.Context) (int, error) {
+	return w.flush(ctx)
+}
+
+func (w *webhookWriter) flush(ctx context.Context) (lost int, err error) {
+	w.lock.Lock()
+	sendings := w.queue
+	w.queue = make([][]byte, 0)
+	w.lock.Unlock()
+
+	for len(sendings) > 0 {
+		n := len(sendings)
+		if w.batchSize > 0 && n > w.batchSize {
+			n = w.batchSize
+		}
+		batch := sendings[0:n]
+		sendings = sendings[n:]
+
+		data, makeErr := w.makeBody(batch)
+		if makeErr == nil {
+			makeErr = postWithRetry(ctx, w.client, w.url, data, w.header, w.retry)
+		}
+		if makeErr != nil {
+			log.Println("webhook sent failed", makeErr.Error(), len(batch))
+			lost += len(batch)
+			err = makeErr
+		}
+	}
+	return lost, err
+}
+
+// makeBody 按格式生成请求内容
+func (w *webhookWriter) makeBody(batch [][]byte) ([]byte, error) {
+	if w.template != nil {
+		logs := make([]map[string]interface{}, 0, len(batch))
+		for _, data := range batch {
+			l := map[string]interface{}{}
+			if json.Unmarshal(data, &l) != nil {
+				l["undefined"] = string(data)
+			}
+			logs = append(logs, l)
+		}
+		buf := new(bytes.Buffer)
+		if err := w.template.Execute(buf, map[string]interface{}{"Logs": logs, "Count": len(logs)}); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	if w.format == "array" {
+		return append(append([]byte{'['}, bytes.Join(batch, []byte{','})...), ']'), nil
+	}
+	return append(bytes.Join(batch, []byte{'\n'}), '\n'), nil
+}
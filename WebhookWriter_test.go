@@ -0,0 +1,79 @@
+package log_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ssgo/log"
+)
+
+func TestWebhookWriter(t *testing.T) {
+	lock := sync.Mutex{}
+	requests := make([]*http.Request, 0)
+	bodies := make([]string, 0)
+	failed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		if r.URL.Path == "/flaky" && !failed {
+			failed = true
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+	}))
+	defer server.Close()
+
+	// ndjson，按 batchSize 拆分请求，失败后重试
+	logger := log.NewLogger(log.Config{File: server.URL + "/flaky?key=abc&batchSize=2&flushInterval=1h&token=t1&header=X-Env:%20test"})
+	logger.Info("a")
+	logger.Info("b")
+	logger.Error("c")
+	if lost, err := logger.Flush(context.Background()); lost != 0 || err != nil {
+		t.Fatal("webhook flush failed", lost, err)
+	}
+
+	// json 数组，只发送 error
+	logger2 := log.NewLogger(log.Config{File: server.URL + "/alert?format=array&level=error", FlushInterval: "10ms"})
+	logger2.Info("ignored")
+	logger2.Error("disk full")
+	logger2.Error("db down")
+	_, _ = logger2.Flush(context.Background())
+
+	// 使用模版生成请求内容
+	tpl := `{"text":{{json (index .Logs 0).error}},"count":{{.Count}}}`
+	logger3 := log.NewLogger(log.Config{File: server.URL + "/bot?level=error&template=" + url.QueryEscape(tpl), FlushInterval: "10ms"})
+	logger3.Error("oops")
+	_, _ = logger3.Flush(context.Background())
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(requests) != 4 {
+		t.Fatal("webhook request test failed", len(requests), bodies)
+	}
+	r := requests[0]
+	if r.URL.RawQuery != "key=abc" || r.Header.Get("Authorization") != "Bearer t1" || r.Header.Get("X-Env") != "test" || r.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Error("webhook header test failed", r.URL.RawQuery, r.Header)
+	}
+	lines := strings.Split(strings.TrimSpace(bodies[0]), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"info":"a"`) || !strings.Contains(lines[1], `"info":"b"`) || !strings.Contains(bodies[1], `"error":"c"`) {
+		t.Error("webhook ndjson test failed", bodies[0], bodies[1])
+	}
+
+	arr := make([]map[string]interface{}, 0)
+	if err := json.Unmarshal([]byte(bodies[2]), &arr); err != nil || len(arr) != 2 || arr[0]["error"] != "disk full" || requests[2].Header.Get("Content-Type") != "application/json" {
+		t.Error("webhook array test failed", bodies[2])
+	}
+	if bodies[3] != `{"text":"oops","count":1}` {
+		t.Error("webhook template test failed", bodies[3])
+	}
+}
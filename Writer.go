@@ -1,7 +1,11 @@
 package log
 
 import (
+	"context"
+	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -10,10 +14,313 @@ type Writer interface {
 	Run()
 }
 
+// FlushWriter 支持按期限写出和关闭的 Writer，返回期限内未能写出而丢失的日志数量
+type FlushWriter interface {
+	Writer
+	Flush(ctx context.Context) (int, error)
+	Close(ctx context.Context) (int, error)
+}
+
+// WakeupWriter 在没有新日志时也需要运行的 Writer（如等待重试）可以实现此接口，NextWakeup 返回距离下一次运行的时间，小于等于0表示不需要
+type WakeupWriter interface {
+	Writer
+	NextWakeup() time.Duration
+}
+
 var writerRunning = false
 var writerLock = sync.RWMutex{}
 var writerStopChan chan bool
-var writers = make([]Writer, 0)
+var queues = make([]*writerQueue, 0)
+
+const defaultQueueSize = 10000
+const defaultFlushSize = 100
+
+// 队列满时的处理策略
+const QueueBlock = "block"           // 阻塞等待，写入端异常时记录日志的调用也会被阻塞
+const QueueDropNewest = "dropNewest" // 丢弃新的日志（默认）
+const QueueDropOldest = "dropOldest" // 丢弃队列中最早的日志
+const QueueDropLevel = "dropLevel"   // 丢弃 debug、info 级别的新日志，warning、error 级别的日志阻塞等待
+
+// writerQueue 日志写入队列，每个队列由独立的协程消费，有日志时被唤醒，达到数量或时间阈值时写出
+type writerQueue struct {
+	ch        chan Log
+	flushSize int
+	interval  time.Duration // 有日志等待写出时的最长等待时间，0 表示队列为空时立即写出
+	policy    string
+	dropped   uint64
+	write     func(Log)
+	flush     func()
+	close     func()
+	wakeup    func() time.Duration
+	lock      sync.Mutex
+	stopChan  chan bool
+	doneChan  chan bool
+	flushChan chan *flushRequest
+	closed    int32
+
+	flushContext func(ctx context.Context) (int, error) // 按期限写出，为空时使用 flush
+	closeContext func(ctx context.Context) (int, error) // 按期限关闭，为空时使用 flush 和 close
+}
+
+type flushRequest struct {
+	ctx    context.Context
+	close  bool
+	result chan flushResult
+}
+
+type flushResult struct {
+	lost int
+	err  error
+}
+
+func newWriterQueue(conf *Config, defaultInterval time.Duration) *writerQueue {
+	q := &writerQueue{
+		flushSize: conf.FlushSize,
+		interval:  defaultInterval,
+		policy:    strings.ToLower(conf.QueuePolicy),
+	}
+	queueSize := conf.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	q.ch = make(chan Log, queueSize)
+	q.flushChan = make(chan *flushRequest)
+	if q.flushSize <= 0 {
+		q.flushSize = defaultFlushSize
+	}
+	if conf.FlushInterval != "" {
+		q.interval = parseDuration(conf.FlushInterval)
+	}
+	return q
+}
+
+// addQueue 注册写入队列，写入已启动时立即开始消费
+func addQueue(q *writerQueue) {
+	writerLock.Lock()
+	queues = append(queues, q)
+	wr := writerRunning
+	writerLock.Unlock()
+	if wr {
+		q.start()
+	}
+}
+
+func (q *writerQueue) put(l Log) {
+	if !writerRunning || atomic.LoadInt32(&q.closed) == 1 {
+		// 未启动时只缓存到队列的容量，避免阻塞
+		select {
+		case q.ch <- l:
+		default:
+			fmt.Println(Viewable(string(l.data)))
+		}
+		return
+	}
+
+	switch q.policy {
+	case strings.ToLower(QueueBlock):
+		q.ch <- l
+	case strings.ToLower(QueueDropOldest):
+		for {
+			select {
+			case q.ch <- l:
+				return
+			default:
+			}
+			select {
+			case <-q.ch:
+				atomic.AddUint64(&q.dropped, 1)
+			default:
+			}
+		}
+	case strings.ToLower(QueueDropLevel):
+		if l.level >= WARNING {
+			q.ch <- l
+			return
+		}
+		select {
+		case q.ch <- l:
+		default:
+			atomic.AddUint64(&q.dropped, 1)
+		}
+	default:
+		// 默认不阻塞记录日志的调用，队列满时丢弃新的日志
+		select {
+		case q.ch <- l:
+		default:
+			atomic.AddUint64(&q.dropped, 1)
+		}
+	}
+}
+
+func (q *writerQueue) start() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.stopChan != nil || atomic.LoadInt32(&q.closed) == 1 {
+		return
+	}
+	if q.doneChan != nil {
+		// 等待上一次的停止完成
+		<-q.doneChan
+	}
+	q.stopChan = make(chan bool)
+	q.doneChan = make(chan bool)
+	go q.run(q.stopChan, q.doneChan)
+}
+
+func (q *writerQueue) stop() {
+	q.lock.Lock()
+	stopChan := q.stopChan
+	doneChan := q.doneChan
+	q.stopChan = nil
+	q.lock.Unlock()
+	if stopChan != nil {
+		close(stopChan)
+		<-doneChan
+	}
+}
+
+func (q *writerQueue) run(stopChan, doneChan chan bool) {
+	defer close(doneChan)
+
+	pending := 0
+	var timer *time.Timer
+	var timerChan <-chan time.Time
+	stopTimer := func() {
+		if timer != nil && timerChan != nil && !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timerChan = nil
+	}
+	setTimer := func(d time.Duration) {
+		stopTimer()
+		if timer == nil {
+			timer = time.NewTimer(d)
+		} else {
+			timer.Reset(d)
+		}
+		timerChan = timer.C
+	}
+	flush := func() {
+		q.flush()
+		pending = 0
+		stopTimer()
+		if q.wakeup != nil {
+			if d := q.wakeup(); d > 0 {
+				setTimer(d)
+			}
+		}
+	}
+
+	if q.wakeup != nil {
+		// 启动时已有待处理的数据（如上次运行遗留的暂存数据）时，不等待新日志即按时唤醒
+		if d := q.wakeup(); d > 0 {
+			setTimer(d)
+		}
+	}
+
+	for {
+		select {
+		case l := <-q.ch:
+			q.write(l)
+			pending++
+			if pending >= q.flushSize || (q.interval <= 0 && len(q.ch) == 0) {
+				flush()
+			} else if pending == 1 && q.interval > 0 {
+				setTimer(q.interval)
+			}
+		case <-timerChan:
+			timerChan = nil
+			flush()
+		case req := <-q.flushChan:
+			stopTimer()
+			lost, err := q.drain(req.ctx, req.close)
+			req.result <- flushResult{lost: lost, err: err}
+			if req.close {
+				return
+			}
+			pending = 0
+			if q.wakeup != nil {
+				if d := q.wakeup(); d > 0 {
+					setTimer(d)
+				}
+			}
+		case <-stopChan:
+			stopTimer()
+			for len(q.ch) > 0 {
+				q.write(<-q.ch)
+			}
+			q.flush()
+			if q.close != nil {
+				q.close()
+			}
+			return
+		}
+	}
+}
+
+// drain 写出请求之前进入队列的日志，期限到达时返回剩余的日志数量
+func (q *writerQueue) drain(ctx context.Context, close bool) (int, error) {
+	n := len(q.ch)
+	for i := 0; i < n; i++ {
+		if ctx.Err() != nil {
+			return n - i, ctx.Err()
+		}
+		q.write(<-q.ch)
+	}
+
+	if close {
+		if q.closeContext != nil {
+			return q.closeContext(ctx)
+		}
+		q.flush()
+		if q.close != nil {
+			q.close()
+		}
+		return 0, nil
+	}
+	if q.flushContext != nil {
+		return q.flushContext(ctx)
+	}
+	q.flush()
+	return 0, nil
+}
+
+// flushWithContext 写出队列中的日志并等待完成，close 为 true 时写出后关闭队列
+func (q *writerQueue) flushWithContext(ctx context.Context, close bool) (int, error) {
+	q.lock.Lock()
+	if atomic.LoadInt32(&q.closed) == 1 {
+		q.lock.Unlock()
+		return 0, nil
+	}
+	if close {
+		atomic.StoreInt32(&q.closed, 1)
+	}
+	if q.stopChan == nil {
+		// 队列没有在运行时直接在当前协程中写出
+		defer q.lock.Unlock()
+		if q.doneChan != nil {
+			<-q.doneChan
+		}
+		return q.drain(ctx, close)
+	}
+	q.lock.Unlock()
+
+	req := &flushRequest{ctx: ctx, close: close, result: make(chan flushResult, 1)}
+	select {
+	case q.flushChan <- req:
+	case <-ctx.Done():
+		return len(q.ch), ctx.Err()
+	}
+	select {
+	case r := <-req.result:
+		return r.lost, r.err
+	case <-ctx.Done():
+		return len(q.ch), ctx.Err()
+	}
+}
 
 func CheckStart() {
 	writerLock.RLock()
@@ -26,13 +333,19 @@ func CheckStart() {
 
 func Start() {
 	writerLock.Lock()
-	defer writerLock.Unlock()
 	if writerRunning {
+		writerLock.Unlock()
 		return
 	}
 	writerRunning = true
 	writerStopChan = make(chan bool)
-	go writerRunner()
+	tmpQueues := make([]*writerQueue, len(queues))
+	copy(tmpQueues, queues)
+	writerLock.Unlock()
+
+	for _, q := range tmpQueues {
+		q.start()
+	}
 }
 
 func Stop() {
@@ -42,59 +355,29 @@ func Stop() {
 		return
 	}
 	writerRunning = false
-}
+	stopChan := writerStopChan
+	tmpQueues := make([]*writerQueue, len(queues))
+	copy(tmpQueues, queues)
 
-func Wait() {
-	if writerStopChan != nil {
-		<-writerStopChan
-		writerStopChan = nil
-	}
-}
-
-func writerRunner() {
-	for {
-		tmpFiles := make([]*File, len(files))
-		filesLock.RLock()
-		i := 0
-		for _, f := range files {
-			tmpFiles[i] = f
-			i++
-		}
-		filesLock.RUnlock()
-		for _, f := range tmpFiles {
-			f.Run()
+	// 在后台写出队列中剩余的日志，完成后通知 Wait
+	go func() {
+		for _, q := range tmpQueues {
+			q.stop()
 		}
+		close(stopChan)
+	}()
+}
 
-		tmpWrites := make([]Writer, len(writers))
-		writerLock.RLock()
-		copy(tmpWrites, writers)
-		writerLock.RUnlock()
-
-		for _, w := range tmpWrites {
-			w.Run()
-		}
-
-		writerLock.RLock()
-		wr := writerRunning
-		writerLock.RUnlock()
-
-		if !wr {
-			time.Sleep(5 * time.Millisecond)
-			for _, f := range tmpFiles {
-				f.Run()
-				f.Close()
-			}
-			for _, w := range tmpWrites {
-				w.Run()
-			}
-			break
+func Wait() {
+	writerLock.RLock()
+	stopChan := writerStopChan
+	writerLock.RUnlock()
+	if stopChan != nil {
+		<-stopChan
+		writerLock.Lock()
+		if writerStopChan == stopChan {
+			writerStopChan = nil
 		}
-
-		// 每10毫秒Run一次
-		time.Sleep(5 * time.Millisecond)
-	}
-
-	if writerStopChan != nil {
-		close(writerStopChan)
+		writerLock.Unlock()
 	}
 }
@@ -1,11 +1,18 @@
 module github.com/ssgo/log
 
-go 1.17
+go 1.22
 
 require (
+	github.com/klauspost/compress v1.18.0
+	github.com/segmentio/kafka-go v0.4.47
 	github.com/ssgo/config v1.7.10
 	github.com/ssgo/standard v1.7.7
 	github.com/ssgo/u v1.7.23
+	go.opentelemetry.io/otel/trace v1.28.0
 )
 
-require gopkg.in/yaml.v3 v3.0.1 // indirect
+require (
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+	go.opentelemetry.io/otel v1.28.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,172 @@
+// Package kafka 提供 kafka://broker1:9092,broker2:9092/topic 写入器，
+// 使用时导入 _ "github.com/ssgo/log/kafka" 进行注册，不使用时不会引入 kafka 的依赖
+package kafka
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	golog "log"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/ssgo/log"
+	"github.com/ssgo/u"
+)
+
+func init() {
+	log.RegisterWriterMaker("kafka", kafkaWriterMaker)
+}
+
+type kafkaWriter struct {
+	config  *log.Config
+	writer  *kafka.Writer
+	timeout time.Duration
+	lock    sync.Mutex
+	queue   []kafka.Message
+}
+
+// kafkaWriterMaker 支持 kafka://broker1:9092,broker2:9092/topic，以 traceId 作为消息的 Key 使同一链路的日志进入同一分区，
+// 参数：acks=all|one|none（默认 one）、compression=gzip|snappy|lz4|zstd、batchSize=100、batchBytes=1M、retry=3、timeout=10s、tls=true
+func kafkaWriterMaker(conf *log.Config) log.Writer {
+	w := new(kafkaWriter)
+	w.config = conf
+	kafkaUrl, err := url.Parse(conf.File)
+	if err != nil {
+		log.DefaultLogger.Error(err.Error(), "conf", conf)
+		return nil
+	}
+	topic := strings.Trim(kafkaUrl.Path, "/")
+	if topic == "" {
+		log.DefaultLogger.Error("kafka topic is required", "conf", conf)
+		return nil
+	}
+
+	q := kafkaUrl.Query()
+	w.timeout = 10 * time.Second
+	if timeout := q.Get("timeout"); timeout != "" {
+		w.timeout = u.Duration(timeout)
+	}
+	w.writer = &kafka.Writer{
+		Addr:         kafka.TCP(u.SplitTrim(kafkaUrl.Host, ",")...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchSize:    conf.FlushSize,
+		BatchTimeout: 10 * time.Millisecond, // 写入队列已经按数量和时间攒批
+		WriteTimeout: w.timeout,
+		ReadTimeout:  w.timeout,
+		RequiredAcks: kafka.RequireOne,
+		MaxAttempts:  4,
+	}
+	if w.writer.BatchSize <= 0 {
+		w.writer.BatchSize = 100
+	}
+	if batchSize := q.Get("batchSize"); batchSize != "" {
+		w.writer.BatchSize = u.Int(batchSize)
+	}
+	if batchBytes := q.Get("batchBytes"); batchBytes != "" {
+		w.writer.BatchBytes = log.ParseSize(batchBytes)
+	}
+	if retry := q.Get("retry"); retry != "" {
+		w.writer.MaxAttempts = u.Int(retry) + 1
+	}
+
+	switch strings.ToLower(q.Get("acks")) {
+	case "all", "-1":
+		w.writer.RequiredAcks = kafka.RequireAll
+	case "none", "0":
+		w.writer.RequiredAcks = kafka.RequireNone
+	}
+
+	switch strings.ToLower(q.Get("compression")) {
+	case "":
+	case "gzip":
+		w.writer.Compression = kafka.Gzip
+	case "snappy":
+		w.writer.Compression = kafka.Snappy
+	case "lz4":
+		w.writer.Compression = kafka.Lz4
+	case "zstd":
+		w.writer.Compression = kafka.Zstd
+	default:
+		log.DefaultLogger.Error("unsupported kafka compression "+q.Get("compression"), "conf", conf)
+	}
+
+	if u.Bool(q.Get("tls")) {
+		w.writer.Transport = &kafka.Transport{TLS: &tls.Config{}}
+	}
+	w.queue = make([]kafka.Message, 0)
+	return w
+}
+
+func (w *kafkaWriter) Log(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	fields := struct {
+		LogTime interface{} // 兼容首字母大写的 Key 和以秒为单位的数字时间
+		TraceId string
+	}{}
+	_ = json.Unmarshal(data, &fields)
+	msg := kafka.Message{Value: append([]byte{}, data...), Time: time.Now()}
+	switch logTime := fields.LogTime.(type) {
+	case string:
+		if tm := log.MakeTime(logTime); !tm.IsZero() {
+			msg.Time = tm
+		}
+	case float64:
+		msg.Time = time.Unix(0, int64(logTime*1e9))
+	}
+	if fields.TraceId != "" {
+		msg.Key = []byte(fields.TraceId)
+	}
+	w.lock.Lock()
+	w.queue = append(w.queue, msg)
+	w.lock.Unlock()
+}
+
+// Run 由写入队列调用，发送缓存的日志
+func (w *kafkaWriter) Run() {
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout*time.Duration(w.writer.MaxAttempts))
+	defer cancel()
+	_, _ = w.flush(ctx)
+}
+
+// Flush 按期限发送缓存的日志，返回发送失败的日志数量
+func (w *kafkaWriter) Flush(ctx context.Context) (int, error) {
+	return w.flush(ctx)
+}
+
+func (w *kafkaWriter) Close(ctx context.Context) (int, error) {
+	lost, err := w.flush(ctx)
+	if closeErr := w.writer.Close(); err == nil {
+		err = closeErr
+	}
+	return lost, err
+}
+
+func (w *kafkaWriter) flush(ctx context.Context) (int, error) {
+	w.lock.Lock()
+	sendings := w.queue
+	w.queue = make([]kafka.Message, 0)
+	w.lock.Unlock()
+	if len(sendings) == 0 {
+		return 0, nil
+	}
+
+	err := w.writer.WriteMessages(ctx, sendings...)
+	if err == nil {
+		return 0, nil
+	}
+	lost := len(sendings)
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) {
+		lost = writeErrors.Count()
+	}
+	golog.Println("kafka sent failed", err.Error(), lost)
+	return lost, err
+}
@@ -0,0 +1,71 @@
+package kafka
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/ssgo/log"
+)
+
+func TestKafkaWriterMaker(t *testing.T) {
+	w, ok := kafkaWriterMaker(&log.Config{File: "kafka://b1:9092,b2:9092/logs?acks=all&compression=lz4&batchSize=50&batchBytes=2M&retry=2&timeout=3s&tls=true"}).(*kafkaWriter)
+	if !ok {
+		t.Fatal("kafka writer maker test failed")
+	}
+	kw := w.writer
+	if kw.Topic != "logs" || kw.Addr.String() != "b1:9092,b2:9092" || kw.RequiredAcks != kafka.RequireAll || kw.Compression != kafka.Lz4 {
+		t.Error("kafka writer settings test failed", kw.Topic, kw.Addr, kw.RequiredAcks, kw.Compression)
+	}
+	if kw.BatchSize != 50 || kw.BatchBytes != 2*1024*1024 || kw.MaxAttempts != 3 || kw.WriteTimeout != 3*time.Second || kw.Transport == nil {
+		t.Error("kafka writer batch settings test failed", kw.BatchSize, kw.BatchBytes, kw.MaxAttempts, kw.WriteTimeout)
+	}
+	if _, ok := kw.Balancer.(*kafka.Hash); !ok {
+		t.Error("kafka writer balancer test failed", kw.Balancer)
+	}
+
+	w = kafkaWriterMaker(&log.Config{File: "kafka://b1:9092/logs", FlushSize: 20}).(*kafkaWriter)
+	if w.writer.BatchSize != 20 || w.writer.RequiredAcks != kafka.RequireOne || w.writer.Compression != 0 || w.writer.MaxAttempts != 4 {
+		t.Error("kafka writer default settings test failed", w.writer.BatchSize, w.writer.RequiredAcks, w.writer.MaxAttempts)
+	}
+	if kafkaWriterMaker(&log.Config{File: "kafka://b1:9092"}) != nil {
+		t.Error("kafka writer topic required test failed")
+	}
+}
+
+func TestKafkaWriterMessageKey(t *testing.T) {
+	w := kafkaWriterMaker(&log.Config{File: "kafka://b1:9092/logs"}).(*kafkaWriter)
+	w.Log([]byte(`{"logTime":"2021-03-04T05:06:07.123Z","traceId":"trace1","info":"a"}`))
+	w.Log([]byte(`{"LogTime":1614834367.5,"info":"b"}`))
+	w.Log([]byte(`{"TraceId":"trace2","info":"c"}`))
+	if len(w.queue) != 3 {
+		t.Fatal("kafka message test failed", len(w.queue))
+	}
+	if string(w.queue[0].Key) != "trace1" || w.queue[0].Time.UTC().Format("2006-01-02T15:04:05.000") != "2021-03-04T05:06:07.123" || string(w.queue[0].Value) != `{"logTime":"2021-03-04T05:06:07.123Z","traceId":"trace1","info":"a"}` {
+		t.Error("kafka message key test failed", string(w.queue[0].Key), w.queue[0].Time)
+	}
+	if w.queue[1].Key != nil || w.queue[1].Time.Unix() != 1614834367 {
+		t.Error("kafka message without trace test failed", string(w.queue[1].Key), w.queue[1].Time)
+	}
+	if string(w.queue[2].Key) != "trace2" {
+		t.Error("kafka message upper case key test failed", string(w.queue[2].Key))
+	}
+}
+
+func TestKafkaWriterUnavailable(t *testing.T) {
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	_ = ln.Close()
+
+	logger := log.NewLogger(log.Config{File: "kafka://" + addr + "/logs?retry=0&timeout=200ms&acks=all&compression=zstd", FlushInterval: "1h"})
+	logger.New("trace1").Info("hello")
+	logger.Info("world")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if lost, err := logger.Close(ctx); lost != 2 || err == nil {
+		t.Error("kafka unavailable test failed", lost, err)
+	}
+}